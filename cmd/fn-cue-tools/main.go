@@ -15,6 +15,7 @@ func main() {
 		packageScriptCommand(),
 		extractSchemaCommand(),
 		cueTestCommand(),
+		schemaCommand(),
 		versionCommand(),
 	)
 	if err := root.Execute(); err != nil {
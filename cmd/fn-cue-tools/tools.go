@@ -18,12 +18,15 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/crossplane-contrib/function-cue/internal/cuetools"
+	"github.com/crossplane-contrib/function-cue/internal/fn"
+	"github.com/crossplane-contrib/function-cue/internal/schema"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -79,7 +82,7 @@ func openapiCommand() *cobra.Command {
 }
 
 func packageScriptCommand() *cobra.Command {
-	var pkg, outFile, out, varName string
+	var pkg, outFile, out, varName, signKeyFile string
 	c := &cobra.Command{
 		Use:   "package-script ./path/to/package/dir",
 		Short: "generate a self-contained script as text",
@@ -87,10 +90,22 @@ func packageScriptCommand() *cobra.Command {
 			if err := checkOneArg(cmd, args); err != nil {
 				return err
 			}
+			var signingKey ed25519.PrivateKey
+			if signKeyFile != "" {
+				b, err := os.ReadFile(signKeyFile)
+				if err != nil {
+					return err
+				}
+				signingKey, err = fn.ParsePrivateKey(b)
+				if err != nil {
+					return err
+				}
+			}
 			out, err := cuetools.PackageScript(args[0], cuetools.PackageScriptOpts{
 				VarName:       varName,
 				OutputPackage: pkg,
 				Format:        cuetools.OutputFormat(out),
+				SigningKey:    signingKey,
 			})
 			if err != nil {
 				return errors.Wrap(err, "generate schemas")
@@ -107,6 +122,7 @@ func packageScriptCommand() *cobra.Command {
 	f.StringVar(&varName, "var", "_script", "the variable name to use for the script, cue format only")
 	f.StringVar(&outFile, "out-file", "", "output file name, default is stdout")
 	f.StringVarP(&out, "output", "o", string(cuetools.FormatCue), "output format, one of cue or raw")
+	f.StringVar(&signKeyFile, "sign", "", "PEM-encoded ed25519 private key file used to sign the script, cue format only")
 	return c
 }
 
@@ -172,5 +188,32 @@ func cueTestCommand() *cobra.Command {
 	f.StringVar(&p.ResponseVar, "response", "response", "response variable to extract")
 	f.BoolVar(&p.LegacyDesiredOnlyResponse, "legacy-response", false, "enable legacy response")
 	f.BoolVar(&p.Debug, "debug", false, "enable eval debugging")
+	f.BoolVar(&p.Schema, "schema", false, "unify request and response with the function schema")
+	return c
+}
+
+func schemaCommand() *cobra.Command {
+	var pkg, outFile string
+	c := &cobra.Command{
+		Use:   "schema",
+		Short: "generate cue definitions for the function request and response",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkNoArgs(cmd, args); err != nil {
+				return err
+			}
+			out, err := schema.Source(pkg)
+			if err != nil {
+				return errors.Wrap(err, "generate schema")
+			}
+			if outFile == "" || outFile == "-" {
+				fmt.Println(string(out))
+				return nil
+			}
+			return writeFile(outFile, out)
+		},
+	}
+	f := c.Flags()
+	f.StringVar(&pkg, "pkg", "fnv1", "package name of generated cue file")
+	f.StringVar(&outFile, "out-file", "", "output file name, defaults to stdout")
 	return c
 }
@@ -37,6 +37,123 @@ const (
 	ScriptSourceInline ScriptSource = "Inline"
 )
 
+// A RequestField is an optional field of the function request that can be made available to the script.
+// +kubebuilder:validation:Enum=meta;extraResources;credentials;input
+type RequestField string
+
+// Supported request fields.
+const (
+	// RequestFieldMeta is the metadata of the request, including the step tag.
+	RequestFieldMeta RequestField = "meta"
+	// RequestFieldExtraResources are the extra resources supplied by Crossplane.
+	RequestFieldExtraResources RequestField = "extraResources"
+	// RequestFieldCredentials are the credentials supplied to the function.
+	RequestFieldCredentials RequestField = "credentials"
+	// RequestFieldInput is the input of the function.
+	RequestFieldInput RequestField = "input"
+)
+
+// A DriftReport specifies how the function reports fields of desired resources that differ from their observed state.
+type DriftReport string
+
+// Supported drift reports.
+const (
+	// DriftReportNone does not report drift.
+	DriftReportNone DriftReport = "none"
+	// DriftReportWarning reports drift as a warning result.
+	DriftReportWarning DriftReport = "warning"
+	// DriftReportDebug reports drift as debug output.
+	DriftReportDebug DriftReport = "debug"
+)
+
+// An OnErrorPolicy specifies how the function responds to errors in evaluating the script.
+type OnErrorPolicy string
+
+// Supported error policies.
+const (
+	// OnErrorFatal returns a fatal result.
+	OnErrorFatal OnErrorPolicy = "fatal"
+	// OnErrorWarn returns the upstream desired state unchanged with a warning result.
+	OnErrorWarn OnErrorPolicy = "warn"
+	// OnErrorLastKnownGood reuses the last successful output of the script for the XR with a warning result.
+	OnErrorLastKnownGood OnErrorPolicy = "lastKnownGood"
+)
+
+// A NamedScript is one of several scripts that are evaluated in sequence.
+type NamedScript struct {
+	// Name identifies the script in logs and errors.
+	Name string `json:"name"`
+	// Script is the inline script.
+	Script string `json:"script"`
+}
+
+// A ScriptRoute selects the scripts for XRs of a specific API group, version and kind.
+type ScriptRoute struct {
+	// Group is the API group of the XR. Matches any group when empty.
+	// +optional
+	Group string `json:"group,omitempty"`
+	// Version is the API version of the XR. Matches any version when empty.
+	// +optional
+	Version string `json:"version,omitempty"`
+	// Kind is the kind of the XR. Matches any kind when empty.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Script is the inline script for matching XRs.
+	// +optional
+	Script string `json:"script,omitempty"`
+	// Scripts is a list of named inline scripts for matching XRs, as an alternative to Script.
+	// +optional
+	Scripts []NamedScript `json:"scripts,omitempty"`
+}
+
+// A ScriptVariant is an alternative script for a subset of XRs.
+type ScriptVariant struct {
+	// Name identifies the variant in logs and errors.
+	Name string `json:"name"`
+	// Script is the inline script used for XRs that the variant applies to.
+	Script string `json:"script"`
+	// LabelSelector selects XRs by their labels. All XRs are selected when not set.
+	// +optional
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	// AnnotationSelector selects XRs by their annotations using the same rules as a label selector.
+	// All XRs are selected when not set.
+	// +optional
+	AnnotationSelector *metav1.LabelSelector `json:"annotationSelector,omitempty"`
+	// Percentage limits the variant to the given percentage of selected XRs, based on a hash of the XR UID.
+	// The same XRs are selected for increasing percentages such that a rollout can be widened gradually.
+	// All selected XRs are included when not set.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	Percentage *int32 `json:"percentage,omitempty"`
+}
+
+// Limits constrain the response produced by the function. A limit of zero means no limit.
+type Limits struct {
+	// MaxDesiredResources is the maximum number of desired resources in the response.
+	// +optional
+	MaxDesiredResources int32 `json:"maxDesiredResources,omitempty"`
+	// MaxResponseBytes is the maximum size of the serialized response in bytes.
+	// +optional
+	MaxResponseBytes int32 `json:"maxResponseBytes,omitempty"`
+	// MaxContextKeys is the maximum number of keys in the context of the response.
+	// +optional
+	MaxContextKeys int32 `json:"maxContextKeys,omitempty"`
+}
+
+// EvalBudget limits the statistics of the cue evaluation of a script. A limit of zero means no limit.
+type EvalBudget struct {
+	// MaxUnifications is the maximum number of unifications.
+	// +optional
+	MaxUnifications int64 `json:"maxUnifications,omitempty"`
+	// MaxDisjuncts is the maximum number of disjuncts.
+	// +optional
+	MaxDisjuncts int64 `json:"maxDisjuncts,omitempty"`
+	// MaxConjuncts is the maximum number of conjuncts.
+	// +optional
+	MaxConjuncts int64 `json:"maxConjuncts,omitempty"`
+}
+
 // CueInput can be used to provide input to the function.
 // +kubebuilder:object:root=true
 // +kubebuilder:storageversion
@@ -51,12 +168,34 @@ type CueInput struct {
 	// Script specifies an inline script
 	// +optional
 	Script string `json:"script,omitempty"`
+	// Scripts is a list of named inline scripts that are evaluated in sequence, as an alternative to Script.
+	// Each script sees the request with the desired state and context updated by the output of the scripts
+	// before it. This allows composing a resource from reusable modules in a single step.
+	// +optional
+	Scripts []NamedScript `json:"scripts,omitempty"`
 	// RequestVar is the variable name that the function will use to provide inputs to the
 	// cue script. Defaults to "#request"
 	RequestVar string `json:"requestVar,omitempty"`
 	// ResponseVar is the variable name that the function will expect the response to be returned as.
 	// Defaults to "response". The special value "." means "use the entire object returned by the script".
 	ResponseVar string `json:"responseVar,omitempty"`
+	// RequestFields is a list of additional fields of the function request that are made available to the script,
+	// in addition to the observed and desired state and the context that are always included. Supported values are
+	// "meta" for the step tag, "extraResources", "input" for this input, and "credentials". Credentials are never
+	// included unless listed here and are always redacted in debug output.
+	// +optional
+	RequestFields []RequestField `json:"requestFields,omitempty"`
+	// Schema unifies the request and response variables of the script with the CUE definitions of the function
+	// request and response before evaluation, such that typos like "desired.resource" fail with a precise error.
+	// The definitions can be written to a file using "fn-cue-tools schema". Not supported for legacy responses.
+	// +optional
+	Schema bool `json:"schema,omitempty"`
+	// Partial renders the desired resources that are concrete when others are not, instead of failing.
+	// Resources that are not concrete are left out, and a normal result lists them along with the reason.
+	// The function still fails when a resource that is not concrete has already been observed, since leaving
+	// it out would delete it.
+	// +optional
+	Partial bool `json:"partial,omitempty"`
 	// LegacyDesiredOnlyResponse provides backward compatibility with older versions
 	// of the function when the function only expected the desired state to be returned.
 	// When set, the response is unmarshalled into a State message instead of
@@ -66,7 +205,7 @@ type CueInput struct {
 	// Debug prints inputs to and outputs of the cue script for all XRs.
 	// Inputs are pre-processed to remove typically irrelevant information like
 	// the last applied kubectl annotation, managed fields etc.
-	// Objects are displayed in compact cue format. (the equivalent of `cue fmt -s`)
+	// Objects are displayed in the debug format, by default in simplified cue format (the equivalent of `cue fmt -s`).
 	// When false, individual XRs can still be debugged by annotating them with
 	//    function-cue/debug: "true"
 	// +optional
@@ -84,4 +223,92 @@ type CueInput struct {
 	// DebugScript displays the full generated script that is executed.
 	// +optional
 	DebugScript bool `json:"debugScript,omitempty"`
+	// DebugFormat is the format in which debug payloads are rendered. The values "cue", "yaml" and "json"
+	// emit the payload as a field of a structured log entry that also carries the XR name and step tag.
+	// The value "text" writes unstructured, delimited blocks to the pod log as older versions of the function did.
+	// Defaults to the format configured for the function server, which is "cue" unless overridden.
+	// +kubebuilder:validation:Enum=text;cue;yaml;json
+	// +optional
+	DebugFormat string `json:"debugFormat,omitempty"`
+	// DebugDrop is a list of path patterns for attributes that are removed from debug output, in addition
+	// to the system attributes that are always removed. Paths are dot-separated keys of the request or response
+	// object where list indices are not part of the path. A segment can contain the wildcards "*" and "?" that
+	// match within a single key, or be "**" which matches any number of keys. Literal dots in a key must be
+	// escaped with a backslash, e.g. "**.annotations.example\.com/*". Ignored when DebugRaw is set.
+	// +optional
+	DebugDrop []string `json:"debugDrop,omitempty"`
+	// DebugRedact is a list of path patterns, in the same form as DebugDrop, for attributes whose values are
+	// replaced with "<redacted>" in debug output for both requests and responses. Redaction also applies when
+	// DebugRaw is set.
+	// +optional
+	DebugRedact []string `json:"debugRedact,omitempty"`
+	// DebugChanges replaces the request and response in debug output with a summary of the changes
+	// that the step makes to the desired state. The summary lists the desired resources that were added or
+	// replaced, the paths of fields that differ from the upstream desired state and from the observed state,
+	// and a diff of the upstream desired state against the desired state after the step.
+	// +optional
+	DebugChanges bool `json:"debugChanges,omitempty"`
+	// DriftReport compares the fields of every desired resource, after the response of the script has been merged,
+	// with the matching observed resource and reports the fields that Crossplane will still need to change.
+	// This helps in understanding why an XR does not settle and in finding scripts that set fields that the
+	// provider defaults to a different value. The value "warning" adds a warning result, "debug" produces
+	// debug output, and "none", the default, turns the report off.
+	// +kubebuilder:validation:Enum=none;warning;debug
+	// +optional
+	DriftReport DriftReport `json:"driftReport,omitempty"`
+	// OnError specifies how errors in evaluating the script are handled. The value "fatal", the default, fails the
+	// function. The value "warn" returns the desired state of previous steps unchanged with a warning result. Note that
+	// this causes resources that the script would have produced to be deleted. The value "lastKnownGood" merges the
+	// last successful output of the same script for the XR, held in memory, with a warning result. It fails the
+	// function when no such output is available, for example after a restart of the function.
+	// +kubebuilder:validation:Enum=fatal;warn;lastKnownGood
+	// +optional
+	OnError OnErrorPolicy `json:"onError,omitempty"`
+	// ShadowScript is a candidate version of the script that is evaluated for every request in addition to
+	// the script. Its output is discarded and only differences in the desired state are logged, which allows
+	// testing a new version of a script against real traffic before switching over.
+	// +optional
+	ShadowScript string `json:"shadowScript,omitempty"`
+	// Variants are alternative scripts for subsets of XRs, for example to roll out a new version of a script to
+	// XRs of a development environment first. The first variant that applies to an XR is used in place of
+	// the script. XRs that no variant applies to use the script.
+	// +optional
+	Variants []ScriptVariant `json:"variants,omitempty"`
+	// Routes select scripts based on the API group, version and kind of the XR, such that a single step can serve
+	// several XR types or several versions of an XRD during a migration. The first matching route replaces the
+	// script, scripts, variants and shadow script. XRs that no route matches use the script or scripts.
+	// +optional
+	Routes []ScriptRoute `json:"routes,omitempty"`
+	// AutoReady sets the readiness of every desired resource produced by the script that does not set it,
+	// based on the Ready condition of the matching observed resource. This removes the need for a separate
+	// function in the pipeline that does the same.
+	// +optional
+	AutoReady bool `json:"autoReady,omitempty"`
+	// AutoReadyComposite additionally sets the readiness of the composite, when not set by the script,
+	// to ready when all desired resources are ready. Requires AutoReady.
+	// +optional
+	AutoReadyComposite bool `json:"autoReadyComposite,omitempty"`
+	// Limits constrain the response after the output of the script has been merged, such that a runaway
+	// script fails with a readable error instead of producing an unreasonably large response. Limits configured
+	// for the function server take precedence when they are lower.
+	// +optional
+	Limits *Limits `json:"limits,omitempty"`
+	// ImmutableFields are dotted paths of fields, for example `spec.forProvider.region`, that must not change once
+	// a resource has been observed. The function fails when a desired resource sets a different value at any of
+	// these paths than its observed state, which prevents accidental replacement of external resources. A literal
+	// dot in a path segment is escaped as `\.`.
+	// +optional
+	ImmutableFields []string `json:"immutableFields,omitempty"`
+	// EvalBudget fails the evaluation of a script whose cue evaluation statistics exceed the supplied limits,
+	// such that a change that makes a script much more expensive to evaluate is noticed.
+	// +optional
+	EvalBudget *EvalBudget `json:"evalBudget,omitempty"`
+	// ScriptDigest is the digest of the script in the form `sha256:<hex>`. The function refuses to evaluate
+	// a script that does not match its digest.
+	// +optional
+	ScriptDigest string `json:"scriptDigest,omitempty"`
+	// ScriptSignature is a base64-encoded ed25519 signature of the script digest. When the function server is
+	// configured with a public key, only scripts with a digest and a valid signature are evaluated.
+	// +optional
+	ScriptSignature string `json:"scriptSignature,omitempty"`
 }
@@ -5,6 +5,7 @@
 package v1beta1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -13,6 +14,55 @@ func (in *CueInput) DeepCopyInto(out *CueInput) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Scripts != nil {
+		in, out := &in.Scripts, &out.Scripts
+		*out = make([]NamedScript, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequestFields != nil {
+		in, out := &in.RequestFields, &out.RequestFields
+		*out = make([]RequestField, len(*in))
+		copy(*out, *in)
+	}
+	if in.DebugDrop != nil {
+		in, out := &in.DebugDrop, &out.DebugDrop
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DebugRedact != nil {
+		in, out := &in.DebugRedact, &out.DebugRedact
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Variants != nil {
+		in, out := &in.Variants, &out.Variants
+		*out = make([]ScriptVariant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]ScriptRoute, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Limits != nil {
+		in, out := &in.Limits, &out.Limits
+		*out = new(Limits)
+		**out = **in
+	}
+	if in.ImmutableFields != nil {
+		in, out := &in.ImmutableFields, &out.ImmutableFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.EvalBudget != nil {
+		in, out := &in.EvalBudget, &out.EvalBudget
+		*out = new(EvalBudget)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CueInput.
@@ -32,3 +82,98 @@ func (in *CueInput) DeepCopyObject() runtime.Object {
 	}
 	return nil
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EvalBudget) DeepCopyInto(out *EvalBudget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EvalBudget.
+func (in *EvalBudget) DeepCopy() *EvalBudget {
+	if in == nil {
+		return nil
+	}
+	out := new(EvalBudget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Limits) DeepCopyInto(out *Limits) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Limits.
+func (in *Limits) DeepCopy() *Limits {
+	if in == nil {
+		return nil
+	}
+	out := new(Limits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamedScript) DeepCopyInto(out *NamedScript) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamedScript.
+func (in *NamedScript) DeepCopy() *NamedScript {
+	if in == nil {
+		return nil
+	}
+	out := new(NamedScript)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScriptRoute) DeepCopyInto(out *ScriptRoute) {
+	*out = *in
+	if in.Scripts != nil {
+		in, out := &in.Scripts, &out.Scripts
+		*out = make([]NamedScript, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScriptRoute.
+func (in *ScriptRoute) DeepCopy() *ScriptRoute {
+	if in == nil {
+		return nil
+	}
+	out := new(ScriptRoute)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScriptVariant) DeepCopyInto(out *ScriptVariant) {
+	*out = *in
+	if in.LabelSelector != nil {
+		in, out := &in.LabelSelector, &out.LabelSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AnnotationSelector != nil {
+		in, out := &in.AnnotationSelector, &out.AnnotationSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Percentage != nil {
+		in, out := &in.Percentage, &out.Percentage
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScriptVariant.
+func (in *ScriptVariant) DeepCopy() *ScriptVariant {
+	if in == nil {
+		return nil
+	}
+	out := new(ScriptVariant)
+	in.DeepCopyInto(out)
+	return out
+}
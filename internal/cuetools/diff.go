@@ -25,8 +25,7 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/pkg/errors"
-	godiff "github.com/pmezard/go-difflib/difflib"
+	"github.com/crossplane-contrib/function-cue/internal/diff"
 )
 
 const (
@@ -34,18 +33,11 @@ const (
 )
 
 func printNativeDiffs(expectedString, actualString string) error {
-	ud := godiff.UnifiedDiff{
-		A:        godiff.SplitLines(expectedString),
-		B:        godiff.SplitLines(actualString),
-		FromFile: "expected",
-		ToFile:   "actual",
-		Context:  3,
-	}
-	s, err := godiff.GetUnifiedDiffString(ud)
+	s, err := diff.Unified(expectedString, actualString, "expected", "actual")
 	if err != nil {
-		return errors.Wrap(err, "diff expected against actual")
+		return err
 	}
-	_, _ = fmt.Fprintf(TestOutput, "diffs found:\n%s\n", strings.TrimSpace(s))
+	_, _ = fmt.Fprintf(TestOutput, "diffs found:\n%s\n", s)
 	return nil
 }
 
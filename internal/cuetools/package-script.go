@@ -19,10 +19,12 @@ package cuetools
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 
 	"cuelang.org/go/cmd/cue/cmd"
+	"github.com/crossplane-contrib/function-cue/internal/fn"
 	"github.com/pkg/errors"
 )
 
@@ -57,14 +59,16 @@ const (
 )
 
 type PackageScriptOpts struct {
-	Format        OutputFormat // output format
-	OutputPackage string       // package to declare for cue output
-	VarName       string       // variable name to use for cue output, default _script
+	Format        OutputFormat       // output format
+	OutputPackage string             // package to declare for cue output
+	VarName       string             // variable name to use for cue output, default _script
+	SigningKey    ed25519.PrivateKey // key used to sign the script, cue output only
 }
 
 // PackageScript generates self-contained definitions from the supplied directory and returns cue code for an object
 // with a _script property that contains the code as a string. The returned object has a package declaration
-// for the package supplied.
+// for the package supplied. When a signing key is supplied, the object also has _scriptDigest and _scriptSignature
+// properties, named after the variable, for the scriptDigest and scriptSignature attributes of the input.
 func PackageScript(dir string, opts PackageScriptOpts) (_ []byte, finalErr error) {
 	defs, err := runDefCommand(dir)
 	if err != nil {
@@ -72,6 +76,9 @@ func PackageScript(dir string, opts PackageScriptOpts) (_ []byte, finalErr error
 	}
 
 	if opts.Format == FormatRaw {
+		if opts.SigningKey != nil {
+			return nil, fmt.Errorf("signing is only supported for cue output")
+		}
 		return defs, nil
 	}
 
@@ -90,5 +97,9 @@ func PackageScript(dir string, opts PackageScriptOpts) (_ []byte, finalErr error
 // generated by %s, DO NOT EDIT
 %s: %s
 `, header, generator, varName, jsonString)
+	if opts.SigningKey != nil {
+		digest, signature := fn.SignScript(opts.SigningKey, string(defs))
+		outputCode += fmt.Sprintf("%sDigest:    %q\n%sSignature: %q\n", varName, digest, varName, signature)
+	}
 	return []byte(outputCode), nil
 }
@@ -18,8 +18,16 @@
 package cuetools
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"regexp"
 	"testing"
 
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/crossplane-contrib/function-cue/internal/fn"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -37,3 +45,33 @@ func TestPackageScript(t *testing.T) {
 	assert.NotContains(t, string(script), "package composition\n")
 	assert.NotContains(t, string(script), `_script: "`)
 }
+
+func TestPackageScriptSigned(t *testing.T) {
+	restore := chdirCueRoot(t)
+	defer restore()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	out, err := PackageScript("./runtime", PackageScriptOpts{
+		OutputPackage: "composition",
+		Format:        FormatCue,
+		VarName:       "script",
+		SigningKey:    priv,
+	})
+	require.NoError(t, err)
+	val := cuecontext.New().CompileBytes(out)
+	require.NoError(t, val.Err())
+	script, err := val.LookupPath(cue.ParsePath("script")).String()
+	require.NoError(t, err)
+	digest, err := val.LookupPath(cue.ParsePath("scriptDigest")).String()
+	require.NoError(t, err)
+	signature, err := val.LookupPath(cue.ParsePath("scriptSignature")).String()
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^sha256:[0-9a-f]{64}$`), digest)
+	assert.Equal(t, fn.ScriptDigest(script), digest)
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	require.NoError(t, err)
+	assert.True(t, ed25519.Verify(pub, []byte(digest), sig))
+
+	_, err = PackageScript("./runtime", PackageScriptOpts{Format: FormatRaw, SigningKey: priv})
+	require.Error(t, err)
+}
@@ -47,6 +47,7 @@ type TestConfig struct {
 	ResponseVar               string
 	LegacyDesiredOnlyResponse bool
 	Debug                     bool
+	Schema                    bool
 }
 
 type Tester struct {
@@ -136,7 +137,7 @@ func evalPackage(pkg string, tag string, expr string, into proto.Message) (final
 // Run runs all tests and returns a consolidated error.
 func (t *Tester) Run() error {
 	var errs []error
-	function, err := fn.New(fn.Options{Debug: t.config.Debug})
+	function, err := fn.New(fn.Options{Debug: t.config.Debug, DebugFormat: fn.DebugFormatText})
 	if err != nil {
 		return errors.Wrap(err, "create function executor")
 	}
@@ -220,6 +221,7 @@ func (t *Tester) runTest(f *fn.Cue, codeBytes []byte, tag string) (finalErr erro
 		RequestVar:          requestVar,
 		ResponseVar:         responseVar,
 		DesiredOnlyResponse: t.config.LegacyDesiredOnlyResponse,
+		Schema:              t.config.Schema,
 		Debug:               fn.DebugOptions{Enabled: t.config.Debug},
 	}
 	actual, err := f.Eval(&req, string(codeBytes), opts)
@@ -0,0 +1,43 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package diff provides a unified differ for text that is shared between the function and its tooling.
+package diff
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	godiff "github.com/pmezard/go-difflib/difflib"
+)
+
+// Unified returns the unified diff between the supplied strings using the supplied names for them and 3 lines
+// of context. It returns an empty string if the two strings are the same.
+func Unified(from, to string, fromName, toName string) (string, error) {
+	ud := godiff.UnifiedDiff{
+		A:        godiff.SplitLines(from),
+		B:        godiff.SplitLines(to),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	}
+	s, err := godiff.GetUnifiedDiffString(ud)
+	if err != nil {
+		return "", errors.Wrapf(err, "diff %s against %s", fromName, toName)
+	}
+	return strings.TrimSpace(s), nil
+}
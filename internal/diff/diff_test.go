@@ -0,0 +1,35 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnified(t *testing.T) {
+	s, err := Unified("a\nb\nc\n", "a\nb\nc\n", "expected", "actual")
+	require.NoError(t, err)
+	assert.Equal(t, "", s)
+
+	s, err = Unified("a\nb\nc\n", "a\nx\nc\n", "expected", "actual")
+	require.NoError(t, err)
+	assert.Equal(t, "--- expected\n+++ actual\n@@ -1,4 +1,4 @@\n a\n-b\n+x\n c", s)
+}
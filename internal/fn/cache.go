@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// requestHash returns a hex-encoded sha256 hash of the supplied request, which includes the input and the script,
+// after removing system attributes. Requests with the same hash produce the same output.
+func requestHash(req *fnv1.RunFunctionRequest) (string, error) {
+	b, err := protojson.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	var obj any
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return "", err
+	}
+	// system attributes change without affecting the output of a script, such as the resource version
+	walkDelete(obj, "", false)
+	// maps are marshaled with sorted keys, which makes the serialization stable
+	b, err = json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// resultEntry is a cached response.
+type resultEntry struct {
+	expires time.Time
+	res     *fnv1.RunFunctionResponse
+}
+
+// resultCache holds responses keyed by request hash for a limited time.
+type resultCache struct {
+	l       sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]resultEntry
+	now     func() time.Time
+}
+
+func newResultCache(ttl time.Duration, size int) *resultCache {
+	return &resultCache{ttl: ttl, size: size, entries: map[string]resultEntry{}, now: time.Now}
+}
+
+// get returns a copy of the unexpired response for the supplied key.
+func (c *resultCache) get(key string) (*fnv1.RunFunctionResponse, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	res, _ := proto.Clone(e.res).(*fnv1.RunFunctionResponse)
+	return res, true
+}
+
+// put stores a copy of the supplied response under the supplied key. When the cache is full, expired entries are
+// removed first, followed by the entry that expires soonest.
+func (c *resultCache) put(key string, res *fnv1.RunFunctionResponse) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	now := c.now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+				continue
+			}
+			if oldestKey == "" || e.expires.Before(oldest) {
+				oldestKey, oldest = k, e.expires
+			}
+		}
+		if len(c.entries) >= c.size {
+			delete(c.entries, oldestKey)
+		}
+	}
+	out, _ := proto.Clone(res).(*fnv1.RunFunctionResponse)
+	c.entries[key] = resultEntry{expires: now.Add(c.ttl), res: out}
+}
+
+// len returns the number of entries in the cache, including expired ones that have not been removed yet.
+func (c *resultCache) len() int {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return len(c.entries)
+}
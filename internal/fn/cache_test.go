@@ -0,0 +1,240 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func cacheTestRequest(t *testing.T, resourceVersion, region string) *fnv1.RunFunctionRequest {
+	var req fnv1.RunFunctionRequest
+	err := protojson.Unmarshal([]byte(`{
+		"observed": {
+			"composite": { "resource": {
+				"apiVersion": "v1",
+				"kind": "MyKind",
+				"metadata": { "name": "xr", "resourceVersion": "`+resourceVersion+`" },
+				"spec": { "region": "`+region+`" }
+			} }
+		}
+	}`), &req)
+	require.NoError(t, err)
+	req.Input = makeInput(t, input.CueInput{Script: `
+response: desired: resources: bucket: resource: spec: region: #request.observed.composite.resource.spec.region
+`})
+	return &req
+}
+
+func TestRequestHash(t *testing.T) {
+	h1, err := requestHash(cacheTestRequest(t, "1", "us-east-1"))
+	require.NoError(t, err)
+	h2, err := requestHash(cacheTestRequest(t, "2", "us-east-1"))
+	require.NoError(t, err)
+	h3, err := requestHash(cacheTestRequest(t, "1", "us-west-2"))
+	require.NoError(t, err)
+	assert.Equal(t, h1, h2)
+	assert.NotEqual(t, h1, h3)
+}
+
+func TestResultCache(t *testing.T) {
+	now := time.Now()
+	c := newResultCache(time.Minute, 2)
+	c.now = func() time.Time { return now }
+	c.put("a", &fnv1.RunFunctionResponse{Meta: &fnv1.ResponseMeta{Tag: "a"}})
+	now = now.Add(time.Second)
+	c.put("b", &fnv1.RunFunctionResponse{Meta: &fnv1.ResponseMeta{Tag: "b"}})
+	res, ok := c.get("a")
+	require.True(t, ok)
+	assert.Equal(t, "a", res.GetMeta().GetTag())
+
+	// the entry that expires soonest is evicted
+	now = now.Add(10 * time.Second)
+	c.put("c", &fnv1.RunFunctionResponse{})
+	_, ok = c.get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 2, c.len())
+
+	// entries expire after the TTL
+	now = now.Add(55 * time.Second)
+	_, ok = c.get("b")
+	assert.False(t, ok)
+	_, ok = c.get("c")
+	assert.True(t, ok)
+}
+
+func TestRunFunctionResultCache(t *testing.T) {
+	f, err := New(Options{ResultCacheTTL: time.Minute})
+	require.NoError(t, err)
+	res1, err := f.RunFunction(context.Background(), cacheTestRequest(t, "1", "us-east-1"))
+	require.NoError(t, err)
+	res2, err := f.RunFunction(context.Background(), cacheTestRequest(t, "2", "us-east-1"))
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.metrics.cacheHits))
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.metrics.cacheMisses))
+	assert.Equal(t, 1.0, testutil.ToFloat64(f.metrics.cacheEntries))
+	assert.Equal(t, protojson.Format(res1), protojson.Format(res2))
+
+	_, err = f.RunFunction(context.Background(), cacheTestRequest(t, "3", "us-west-2"))
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, testutil.ToFloat64(f.metrics.cacheMisses))
+}
+
+func TestRunFunctionResultCacheBypass(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		setup   func(req *fnv1.RunFunctionRequest)
+	}{
+		{
+			name:    "server debug",
+			options: Options{Debug: true},
+		},
+		{
+			name: "debug annotation",
+			setup: func(req *fnv1.RunFunctionRequest) {
+				req.Observed.Composite.Resource.Fields["metadata"].GetStructValue().
+					Fields["annotations"] = structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+					debugAnnotation: structpb.NewStringValue("true"),
+				}})
+			},
+		},
+		{
+			name:    "recording",
+			options: Options{RecordAll: true},
+		},
+		{
+			name: "drift debug",
+			setup: func(req *fnv1.RunFunctionRequest) {
+				req.Input = makeInput(t, input.CueInput{
+					Script:      `response: desired: resources: bucket: resource: spec: region: "us-east-1"`,
+					DriftReport: input.DriftReportDebug,
+				})
+			},
+		},
+		{
+			name: "recovered",
+			setup: func(req *fnv1.RunFunctionRequest) {
+				req.Input = makeInput(t, input.CueInput{Script: `response: foo: bar: _|_`, OnError: input.OnErrorWarn})
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := test.options
+			opts.ResultCacheTTL = time.Minute
+			if opts.RecordAll {
+				opts.RecordDir = t.TempDir()
+			}
+			f, err := New(opts)
+			require.NoError(t, err)
+			for i := 0; i < 2; i++ {
+				req := cacheTestRequest(t, "1", "us-east-1")
+				if test.setup != nil {
+					test.setup(req)
+				}
+				_, err := f.RunFunction(context.Background(), req)
+				require.NoError(t, err)
+			}
+			assert.Equal(t, 0.0, testutil.ToFloat64(f.metrics.cacheHits))
+			assert.Equal(t, 2.0, testutil.ToFloat64(f.metrics.cacheMisses))
+			assert.Equal(t, 0, f.results.len())
+		})
+	}
+}
+
+// gatedLogger is a logger that blocks the first evaluation that succeeds until it is released.
+type gatedLogger struct {
+	logging.Logger
+	once    *sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newGatedLogger() *gatedLogger {
+	return &gatedLogger{
+		Logger:  logging.NewNopLogger(),
+		once:    &sync.Once{},
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+func (g *gatedLogger) Info(msg string, _ ...any) {
+	if msg == "cue module executed successfully" {
+		g.once.Do(func() {
+			close(g.entered)
+			<-g.release
+		})
+	}
+}
+
+func (g *gatedLogger) WithValues(_ ...any) logging.Logger {
+	return g
+}
+
+func TestRunFunctionConcurrentRequests(t *testing.T) {
+	logger := newGatedLogger()
+	f, err := New(Options{Logger: logger, History: 100})
+	require.NoError(t, err)
+	const n = 20
+	responses := make([]*fnv1.RunFunctionResponse, n)
+	errs := make([]error, n)
+	var wg, started sync.WaitGroup
+	run := func(i int) {
+		req := cacheTestRequest(t, fmt.Sprint(i), "us-east-1")
+		wg.Add(1)
+		started.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			responses[i], errs[i] = f.RunFunction(context.Background(), req)
+		}()
+	}
+	// the first evaluation blocks until all other requests are waiting for it
+	run(0)
+	<-logger.entered
+	for i := 1; i < n; i++ {
+		run(i)
+	}
+	started.Wait()
+	time.Sleep(100 * time.Millisecond)
+	close(logger.release)
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, protojson.Format(responses[0]), protojson.Format(responses[i]))
+		if i > 0 {
+			assert.NotSame(t, responses[0], responses[i])
+		}
+	}
+	assert.Len(t, f.history.list(""), 1)
+}
@@ -0,0 +1,227 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/crossplane-contrib/function-cue/internal/diff"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/ghodss/yaml"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// fieldDiffs appends the paths of fields in `to` that are different from, or missing in, `from` to the supplied list.
+// When removed is true, the paths of fields in `from` that are missing in `to` are also added.
+func fieldDiffs(from, to any, path string, removed bool, out *[]string) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	switch to := to.(type) {
+	case map[string]any:
+		fromMap, ok := from.(map[string]any)
+		if !ok {
+			*out = append(*out, path)
+			return
+		}
+		for k, v := range to {
+			fromV, ok := fromMap[k]
+			if !ok {
+				*out = append(*out, join(k))
+				continue
+			}
+			fieldDiffs(fromV, v, join(k), removed, out)
+		}
+		if removed {
+			for k := range fromMap {
+				if _, ok := to[k]; !ok {
+					*out = append(*out, join(k))
+				}
+			}
+		}
+	case []any:
+		fromList, ok := from.([]any)
+		if !ok {
+			*out = append(*out, path)
+			return
+		}
+		for i, v := range to {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			if i >= len(fromList) {
+				*out = append(*out, p)
+				continue
+			}
+			fieldDiffs(fromList[i], v, p, removed, out)
+		}
+		if removed {
+			for i := len(to); i < len(fromList); i++ {
+				*out = append(*out, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	default:
+		if !reflect.DeepEqual(from, to) {
+			*out = append(*out, path)
+		}
+	}
+}
+
+// resourceFieldDiffs returns the sorted paths of fields that differ between the supplied resources.
+func resourceFieldDiffs(from, to *fnv1.Resource, removed bool) []string {
+	var out []string
+	fieldDiffs(from.GetResource().AsMap(), to.GetResource().AsMap(), "", removed, &out)
+	sort.Strings(out)
+	return out
+}
+
+// changeSummary summarizes the changes that a single function step makes to the desired state.
+type changeSummary struct {
+	// Added has the names of desired resources that were added by the step.
+	Added []string `json:"added,omitempty"`
+	// Replaced has the names of desired resources that were replaced by the step.
+	Replaced []string `json:"replaced,omitempty"`
+	// Composite is true if the step set the desired composite.
+	Composite bool `json:"composite,omitempty"`
+	// FromDesired has the paths of fields that differ from the upstream desired state, keyed by resource name.
+	FromDesired map[string][]string `json:"fromDesired,omitempty"`
+	// FromObserved has the paths of fields set by the step that differ from the observed state, keyed by
+	// resource name.
+	FromObserved map[string][]string `json:"fromObserved,omitempty"`
+	// CompositeFromDesired has the paths of fields of the composite that differ from the upstream desired state.
+	CompositeFromDesired []string `json:"compositeFromDesired,omitempty"`
+	// CompositeFromObserved has the paths of fields of the composite set by the step that differ from the
+	// observed state.
+	CompositeFromObserved []string `json:"compositeFromObserved,omitempty"`
+	// Diff is a unified diff of the upstream desired state against the desired state produced by the step,
+	// limited to the resources that were changed.
+	Diff string `json:"diff,omitempty"`
+}
+
+// desiredYAML renders the supplied desired state as YAML for diffs after applying the supplied filter.
+func (f *Cue) desiredYAML(state *fnv1.State, filter *debugFilter) (string, error) {
+	b, err := protojson.Marshal(&fnv1.RunFunctionResponse{Desired: state})
+	if err != nil {
+		return "", err
+	}
+	b, err = f.reserializeWith(b, filter)
+	if err != nil {
+		return "", err
+	}
+	b, err = yaml.JSONToYAML(b)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// summarizeChanges returns a summary of changes to the upstream desired state made by the merged response,
+// given the response from the cue script. The supplied filter is applied to the state before it is diffed.
+func (f *Cue) summarizeChanges(upstream, observed *fnv1.State, cueResponse, merged *fnv1.RunFunctionResponse,
+	filter *debugFilter,
+) (*changeSummary, error) {
+	ret := &changeSummary{
+		FromDesired:  map[string][]string{},
+		FromObserved: map[string][]string{},
+	}
+	before := &fnv1.State{Resources: map[string]*fnv1.Resource{}}
+	after := &fnv1.State{Resources: map[string]*fnv1.Resource{}}
+
+	for name := range cueResponse.GetDesired().GetResources() {
+		newRes := merged.GetDesired().GetResources()[name]
+		oldRes, existed := upstream.GetResources()[name]
+		if existed {
+			ret.Replaced = append(ret.Replaced, name)
+		} else {
+			ret.Added = append(ret.Added, name)
+		}
+		if existed && proto.Equal(oldRes, newRes) {
+			continue
+		}
+		if existed {
+			before.Resources[name] = oldRes
+		}
+		after.Resources[name] = newRes
+		if fields := resourceFieldDiffs(oldRes, newRes, true); len(fields) > 0 {
+			ret.FromDesired[name] = fields
+		}
+		if obs, ok := observed.GetResources()[name]; ok {
+			if fields := resourceFieldDiffs(obs, newRes, false); len(fields) > 0 {
+				ret.FromObserved[name] = fields
+			}
+		}
+	}
+	if cueResponse.GetDesired().GetComposite() != nil {
+		ret.Composite = true
+		newXR := merged.GetDesired().GetComposite()
+		ret.CompositeFromDesired = resourceFieldDiffs(upstream.GetComposite(), newXR, true)
+		if len(ret.CompositeFromDesired) > 0 {
+			before.Composite = upstream.GetComposite()
+			after.Composite = newXR
+		}
+		ret.CompositeFromObserved = resourceFieldDiffs(observed.GetComposite(), newXR, false)
+	}
+	sort.Strings(ret.Added)
+	sort.Strings(ret.Replaced)
+
+	beforeYAML, err := f.desiredYAML(before, filter)
+	if err != nil {
+		return nil, err
+	}
+	afterYAML, err := f.desiredYAML(after, filter)
+	if err != nil {
+		return nil, err
+	}
+	ret.Diff, err = diff.Unified(beforeYAML, afterYAML, "upstream", "desired")
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// debugChanges emits a summary of the changes made by the step to the supplied upstream desired state
+// as debug output.
+func (f *Cue) debugChanges(upstream *fnv1.State, req *fnv1.RunFunctionRequest, cueResponse, merged *fnv1.RunFunctionResponse,
+	opts EvalOptions,
+) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = f.log
+	}
+	summary, err := f.summarizeChanges(upstream, req.GetObserved(), cueResponse, merged, f.newDebugFilter(opts.Debug))
+	if err != nil {
+		logger.Info("unable to summarize changes", "error", err)
+		return
+	}
+	b, err := json.Marshal(summary)
+	if err != nil {
+		logger.Info("unable to summarize changes", "error", err)
+		return
+	}
+	dbgFormat := opts.Debug.Format
+	if dbgFormat == "" {
+		dbgFormat = f.debugFormat
+	}
+	// the summary only has field paths and an already filtered diff
+	debugPayload(logger, dbgFormat, "changes", "", f.getFormattedDebugString(b, &debugFilter{raw: true}, dbgFormat))
+}
@@ -0,0 +1,104 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestFieldDiffs(t *testing.T) {
+	from := map[string]any{
+		"a": "x",
+		"b": map[string]any{"c": 1.0, "d": []any{"p", "q"}},
+		"e": "gone",
+	}
+	to := map[string]any{
+		"a": "x",
+		"b": map[string]any{"c": 2.0, "d": []any{"p", "r", "s"}},
+		"f": "new",
+	}
+	var out []string
+	fieldDiffs(from, to, "", true, &out)
+	sort.Strings(out)
+	assert.Equal(t, []string{"b.c", "b.d[1]", "b.d[2]", "e", "f"}, out)
+
+	out = nil
+	fieldDiffs(from, to, "", false, &out)
+	sort.Strings(out)
+	assert.Equal(t, []string{"b.c", "b.d[1]", "b.d[2]", "f"}, out)
+}
+
+func TestDebugChanges(t *testing.T) {
+	var req fnv1.RunFunctionRequest
+	err := protojson.Unmarshal([]byte(`{
+		"observed": {
+			"composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } },
+			"resources": {
+				"main": { "resource": { "spec": { "region": "us-east-1", "size": 1 }, "status": { "id": "x" } } }
+			}
+		},
+		"desired": {
+			"resources": {
+				"main": { "resource": { "spec": { "region": "us-east-1", "size": 1 } } },
+				"other": { "resource": { "foo": "bar" } }
+			}
+		}
+	}`), &req)
+	require.NoError(t, err)
+	req.Input = makeInput(t, input.CueInput{
+		Script: `
+response: desired: resources: {
+	main: resource: spec: { region: "us-west-2", size: 1 }
+	extra: resource: foo: "baz"
+}
+`,
+		Debug:        true,
+		DebugChanges: true,
+	})
+	logger := newRecordingLogger()
+	f, err := New(Options{Logger: logger, DebugFormat: DebugFormatJSON})
+	require.NoError(t, err)
+	res, err := f.RunFunction(context.Background(), &req)
+	require.NoError(t, err)
+	assert.Len(t, res.GetDesired().GetResources(), 3)
+
+	entries := logger.messages("cue debug output")
+	require.Len(t, entries, 1)
+	assert.Equal(t, "changes", entries[0].values["debug-phase"])
+	payload, ok := entries[0].values["debug-payload"].(string)
+	require.True(t, ok)
+	var summary changeSummary
+	require.NoError(t, json.Unmarshal([]byte(payload), &summary))
+	assert.Equal(t, []string{"extra"}, summary.Added)
+	assert.Equal(t, []string{"main"}, summary.Replaced)
+	assert.Equal(t, map[string][]string{"main": {"spec.region"}, "extra": {"foo"}}, summary.FromDesired)
+	assert.Equal(t, map[string][]string{"main": {"spec.region"}}, summary.FromObserved)
+	assert.False(t, summary.Composite)
+	assert.Contains(t, summary.Diff, "-          region: us-east-1\n+          region: us-west-2")
+	assert.Contains(t, summary.Diff, "+    extra:")
+	assert.NotContains(t, summary.Diff, "other")
+}
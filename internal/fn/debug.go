@@ -18,14 +18,46 @@
 package fn
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"log"
 
 	"cuelang.org/go/cue/format"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/ghodss/yaml"
 )
 
 const connectionDetailsKey = "connectionDetails"
 
+// DebugFormat is the format in which debug payloads are rendered.
+type DebugFormat string
+
+// Supported debug formats.
+const (
+	// DebugFormatText writes begin/end delimited blocks in cue format directly to the standard logger, bypassing
+	// the structured logger. This is the format used by older versions of the function.
+	DebugFormatText DebugFormat = "text"
+	// DebugFormatCue emits payloads in cue format, indented with spaces, via the structured logger.
+	DebugFormatCue DebugFormat = "cue"
+	// DebugFormatYAML emits payloads in YAML format via the structured logger.
+	DebugFormatYAML DebugFormat = "yaml"
+	// DebugFormatJSON emits payloads in indented JSON format via the structured logger.
+	DebugFormatJSON DebugFormat = "json"
+)
+
+// ParseDebugFormat returns the debug format for the supplied string, defaulting to cue format when empty.
+func ParseDebugFormat(s string) (DebugFormat, error) {
+	switch f := DebugFormat(s); f {
+	case "":
+		return DebugFormatCue, nil
+	case DebugFormatText, DebugFormatCue, DebugFormatYAML, DebugFormatJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid debug format %q, must be one of text, cue, yaml or json", s)
+	}
+}
+
 // start debugging routines
 
 // noise that people typically wouldn't want to see when looking at inputs.
@@ -54,15 +86,15 @@ func init() {
 }
 
 // walkDelete performs a recursive walk on the supplied object to remove system generated
-// attributes.
-func walkDelete(input any, parent string) {
+// attributes. Values of connection details are redacted when requested.
+func walkDelete(input any, parent string, redact bool) {
 	switch input := input.(type) {
 	case []any:
 		for _, v := range input {
-			walkDelete(v, parent)
+			walkDelete(v, parent, redact)
 		}
 	case map[string]any:
-		if parent == connectionDetailsKey {
+		if redact && parent == connectionDetailsKey {
 			for k := range input {
 				input[k] = []byte("<redacted>")
 			}
@@ -73,38 +105,61 @@ func walkDelete(input any, parent string) {
 				delete(input, k)
 				continue
 			}
-			walkDelete(v, k)
+			walkDelete(v, k, redact)
 		}
 	}
 }
 
 func (f *Cue) reserialize(jsonBytes []byte, raw bool) ([]byte, error) {
+	return f.reserializeWith(jsonBytes, f.newDebugFilter(DebugOptions{Raw: raw}))
+}
+
+func (f *Cue) reserializeWith(jsonBytes []byte, filter *debugFilter) ([]byte, error) {
 	var input any
 	err := json.Unmarshal(jsonBytes, &input)
 	if err != nil {
 		f.log.Info(fmt.Sprintf("JSON unmarshal error: %v", err))
 		return jsonBytes, err
 	}
-	if !raw {
-		walkDelete(input, "")
-	}
-	b, err := json.MarshalIndent(input, "", "  ")
-	if err != nil {
+	filter.apply(input)
+	// do not escape HTML characters since this output is meant to be human-readable
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(input); err != nil {
 		f.log.Info(fmt.Sprintf("JSON marshal error: %v", err))
 		return jsonBytes, err
 	}
-	return b, nil
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
 }
 
 // getDebugString modifies the supplied JSON bytes to remove k8s and crossplane generated metadata
 // and returns its serialized form as a formatted cue object for a better user experience.
 // In case of any errors, it returns the input bytes as a string.
 func (f *Cue) getDebugString(jsonBytes []byte, raw bool) string {
+	return f.getFormattedDebugString(jsonBytes, f.newDebugFilter(DebugOptions{Raw: raw}), DebugFormatCue)
+}
+
+// getFormattedDebugString is the same as getDebugString except that it uses the supplied filter to clean up
+// the object and renders it in the supplied format.
+func (f *Cue) getFormattedDebugString(jsonBytes []byte, filter *debugFilter, dbgFormat DebugFormat) string {
 	var err error
-	jsonBytes, err = f.reserialize(jsonBytes, raw)
+	jsonBytes, err = f.reserializeWith(jsonBytes, filter)
 	if err != nil {
 		return string(jsonBytes)
 	}
+	switch dbgFormat {
+	case DebugFormatJSON:
+		return string(jsonBytes)
+	case DebugFormatYAML:
+		out, err := yaml.JSONToYAML(jsonBytes)
+		if err != nil {
+			f.log.Info(fmt.Sprintf("YAML formatting error: %v", err))
+			return string(jsonBytes)
+		}
+		return string(out)
+	}
 	out, err := format.Source(jsonBytes, format.Simplify(), format.TabIndent(false), format.UseSpaces(2))
 	if err != nil {
 		f.log.Info(fmt.Sprintf("cue formatting error: %v", err))
@@ -112,3 +167,23 @@ func (f *Cue) getDebugString(jsonBytes []byte, raw bool) string {
 	}
 	return string(out)
 }
+
+// debugPayload emits a debug payload for the supplied phase. For the text format, it writes a delimited block
+// to the standard logger with the variable name as a prefix. For all other formats, it uses the supplied
+// structured logger with stable keys such that the output can be processed by log pipelines.
+func debugPayload(logger logging.Logger, dbgFormat DebugFormat, phase, varName, payload string) {
+	if dbgFormat == DebugFormatText {
+		prefix := ""
+		if varName != "" {
+			prefix = varName + ": "
+		}
+		log.Printf("[%s:begin]\n%s%s\n[%s:end]\n", phase, prefix, payload, phase)
+		return
+	}
+	logger.Info("cue debug output",
+		"debug-phase", phase,
+		"debug-var", varName,
+		"debug-format", string(dbgFormat),
+		"debug-payload", payload,
+	)
+}
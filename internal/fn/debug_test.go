@@ -21,15 +21,69 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"testing"
 
 	"cuelang.org/go/cue/cuecontext"
 
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/ghodss/yaml"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// logEntry is a single message logged by the recordingLogger.
+type logEntry struct {
+	msg    string
+	values map[string]any
+}
+
+// recordingLogger is a logger that records all info messages along with their structured values.
+type recordingLogger struct {
+	l       sync.Mutex
+	entries *[]logEntry
+	values  []any
+}
+
+func newRecordingLogger() *recordingLogger {
+	return &recordingLogger{entries: &[]logEntry{}}
+}
+
+func (r *recordingLogger) Info(msg string, keysAndValues ...any) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	values := map[string]any{}
+	all := append(append([]any{}, r.values...), keysAndValues...)
+	for i := 0; i+1 < len(all); i += 2 {
+		values[fmt.Sprint(all[i])] = all[i+1]
+	}
+	*r.entries = append(*r.entries, logEntry{msg: msg, values: values})
+}
+
+func (r *recordingLogger) Debug(msg string, keysAndValues ...any) {
+	r.Info(msg, keysAndValues...)
+}
+
+func (r *recordingLogger) WithValues(keysAndValues ...any) logging.Logger {
+	return &recordingLogger{
+		entries: r.entries,
+		values:  append(append([]any{}, r.values...), keysAndValues...),
+	}
+}
+
+// messages returns all entries logged with the supplied message.
+func (r *recordingLogger) messages(msg string) []logEntry {
+	r.l.Lock()
+	defer r.l.Unlock()
+	var ret []logEntry
+	for _, e := range *r.entries {
+		if e.msg == msg {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
 func yaml2Object(t *testing.T, s string) any {
 	var data any
 	err := yaml.Unmarshal([]byte(s), &data)
@@ -152,3 +206,54 @@ func TestDebugBadJSON(t *testing.T) {
 	s := f.getDebugString([]byte("{ foo:"), true)
 	assert.EqualValues(t, "{ foo:", s)
 }
+
+func TestDebugFormats(t *testing.T) {
+	f, err := New(Options{})
+	require.NoError(t, err)
+	inBytes := []byte(`{"metadata":{"name":"foo","uid":"xxx"}}`)
+
+	s := f.getFormattedDebugString(inBytes, f.newDebugFilter(DebugOptions{}), DebugFormatYAML)
+	assert.Equal(t, "metadata:\n  name: foo\n", s)
+
+	s = f.getFormattedDebugString(inBytes, f.newDebugFilter(DebugOptions{}), DebugFormatJSON)
+	assert.JSONEq(t, `{"metadata":{"name":"foo"}}`, s)
+
+	s = f.getFormattedDebugString(inBytes, f.newDebugFilter(DebugOptions{Raw: true}), DebugFormatCue)
+	assert.Equal(t, "{\n  metadata: {\n    name: \"foo\"\n    uid:  \"xxx\"\n  }\n}\n", s)
+
+	_, err = ParseDebugFormat("xml")
+	require.Error(t, err)
+	df, err := ParseDebugFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, DebugFormatCue, df)
+}
+
+func TestDebugStructuredOutput(t *testing.T) {
+	logger := newRecordingLogger()
+	f, err := New(Options{Logger: logger, DebugFormat: DebugFormatYAML})
+	require.NoError(t, err)
+	script := `
+#request: {...}
+response: desired: resources: main: resource: foo: #request.observed.composite.resource.foo
+`
+	_, err = f.Eval(makeRequest(t), script, EvalOptions{
+		RequestVar:  "#request",
+		ResponseVar: "response",
+		Debug:       DebugOptions{Enabled: true, Script: true},
+		Logger:      logger.WithValues("xr-name", "foo"),
+	})
+	require.NoError(t, err)
+	entries := logger.messages("cue debug output")
+	require.Len(t, entries, 3)
+	phases := []string{"request", "script", "response"}
+	for i, e := range entries {
+		assert.Equal(t, phases[i], e.values["debug-phase"])
+		assert.Equal(t, "foo", e.values["xr-name"])
+	}
+	assert.Equal(t, "#request", entries[0].values["debug-var"])
+	assert.Equal(t, "yaml", entries[0].values["debug-format"])
+	assert.Contains(t, entries[0].values["debug-payload"], "foo: bar\n")
+	assert.Equal(t, "cue", entries[1].values["debug-format"])
+	assert.Equal(t, "response", entries[2].values["debug-var"])
+	assert.Equal(t, "desired:\n  resources:\n    main:\n      resource:\n        foo: bar\n", entries[2].values["debug-payload"])
+}
@@ -0,0 +1,138 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/pkg/errors"
+)
+
+// dependencyReady returns true if the supplied resource has been observed and is ready. Resources without
+// a Ready condition are considered ready once observed.
+func dependencyReady(observed *fnv1.Resource) bool {
+	if observed == nil {
+		return false
+	}
+	ready, known := observedReady(observed)
+	return !known || ready == fnv1.Ready_READY_TRUE
+}
+
+// checkDependencies returns an error if the supplied dependencies refer to resources that are not desired or
+// contain a cycle, either of which would hold back resources forever.
+func checkDependencies(desired *fnv1.State, deps map[string][]string) error {
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var unknown []string
+	for _, name := range names {
+		if _, ok := desired.GetResources()[name]; !ok {
+			unknown = append(unknown, fmt.Sprintf("%s (declares dependencies)", name))
+			continue
+		}
+		for _, dep := range deps[name] {
+			if _, ok := desired.GetResources()[dep]; !ok {
+				unknown = append(unknown, fmt.Sprintf("%s (dependency of %s)", dep, name))
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		return errors.Errorf("dependencies refer to resources that are not desired: %s", strings.Join(unknown, ", "))
+	}
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, p := range path {
+				if p == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return errors.Errorf("dependencies contain a cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	return nil
+}
+
+// holdBackResources removes desired resources that have not been observed yet and whose dependencies are not
+// observed and ready. Resources that already exist are never removed since that would delete them. It returns
+// the names of the dependencies that each removed resource waits for, keyed by resource name.
+func holdBackResources(observed, desired *fnv1.State, deps map[string][]string) map[string][]string {
+	ret := map[string][]string{}
+	for name, dependsOn := range deps {
+		if _, ok := desired.GetResources()[name]; !ok {
+			continue
+		}
+		if _, ok := observed.GetResources()[name]; ok {
+			continue
+		}
+		var waiting []string
+		for _, dep := range dependsOn {
+			if !dependencyReady(observed.GetResources()[dep]) {
+				waiting = append(waiting, dep)
+			}
+		}
+		if len(waiting) > 0 {
+			sort.Strings(waiting)
+			ret[name] = waiting
+			delete(desired.Resources, name)
+		}
+	}
+	return ret
+}
+
+// waitingMessage returns a human-readable message for the supplied held back resources.
+func waitingMessage(waiting map[string][]string) string {
+	names := make([]string, 0, len(waiting))
+	for name := range waiting {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s waits for %s", name, strings.Join(waiting[name], ", ")))
+	}
+	return "resources held back until their dependencies are ready: " + strings.Join(parts, "; ")
+}
@@ -0,0 +1,186 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestDependencies(t *testing.T) {
+	script := `
+response: desired: resources: {
+	primary_bucket: resource: kind: "Bucket"
+	iam_policy: resource: kind:     "Policy"
+	iam_attachment: resource: kind: "Attachment"
+}
+response: dependencies: {
+	iam_policy: ["primary_bucket"]
+	iam_attachment: ["iam_policy", "primary_bucket"]
+}
+`
+	tests := []struct {
+		name      string
+		observed  string
+		resources []string
+		message   string
+	}{
+		{
+			name:      "initial",
+			observed:  `{}`,
+			resources: []string{"primary_bucket"},
+			message: "resources held back until their dependencies are ready: " +
+				"iam_attachment waits for iam_policy, primary_bucket; iam_policy waits for primary_bucket",
+		},
+		{
+			name: "bucket not ready",
+			observed: `{
+				"primary_bucket": { "resource": { "status": { "conditions": [ { "type": "Ready", "status": "False" } ] } } }
+			}`,
+			resources: []string{"primary_bucket"},
+			message: "resources held back until their dependencies are ready: " +
+				"iam_attachment waits for iam_policy, primary_bucket; iam_policy waits for primary_bucket",
+		},
+		{
+			name: "bucket ready",
+			observed: `{
+				"primary_bucket": { "resource": { "status": { "conditions": [ { "type": "Ready", "status": "True" } ] } } }
+			}`,
+			resources: []string{"iam_policy", "primary_bucket"},
+			message:   "resources held back until their dependencies are ready: iam_attachment waits for iam_policy",
+		},
+		{
+			name: "existing resources are kept",
+			observed: `{
+				"primary_bucket": { "resource": { "status": { "conditions": [ { "type": "Ready", "status": "False" } ] } } },
+				"iam_policy": { "resource": { "kind": "Policy" } }
+			}`,
+			resources: []string{"iam_policy", "primary_bucket"},
+			message:   "resources held back until their dependencies are ready: iam_attachment waits for primary_bucket",
+		},
+		{
+			name: "all ready",
+			observed: `{
+				"primary_bucket": { "resource": { "status": { "conditions": [ { "type": "Ready", "status": "True" } ] } } },
+				"iam_policy": { "resource": { "kind": "Policy" } }
+			}`,
+			resources: []string{"iam_attachment", "iam_policy", "primary_bucket"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var req fnv1.RunFunctionRequest
+			err := protojson.Unmarshal([]byte(`{
+				"observed": {
+					"composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } },
+					"resources": `+test.observed+`
+				}
+			}`), &req)
+			require.NoError(t, err)
+			req.Input = makeInput(t, input.CueInput{Script: script})
+			f, err := New(Options{})
+			require.NoError(t, err)
+			res, err := f.RunFunction(context.Background(), &req)
+			require.NoError(t, err)
+			var names []string
+			for name := range res.GetDesired().GetResources() {
+				names = append(names, name)
+			}
+			assert.ElementsMatch(t, test.resources, names)
+			if test.message == "" {
+				require.Len(t, res.GetResults(), 1)
+				return
+			}
+			require.Len(t, res.GetResults(), 2)
+			assert.Equal(t, fnv1.Severity_SEVERITY_NORMAL, res.GetResults()[0].GetSeverity())
+			assert.Equal(t, test.message, res.GetResults()[0].GetMessage())
+		})
+	}
+}
+
+func TestDependencyErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		deps   string
+		errMsg string
+	}{
+		{
+			name:   "unknown dependency",
+			deps:   `iam_policy: ["primary_bukcet"]`,
+			errMsg: "dependencies refer to resources that are not desired: primary_bukcet (dependency of iam_policy)",
+		},
+		{
+			name:   "unknown resource",
+			deps:   `iam_polcy: ["primary_bucket"]`,
+			errMsg: "dependencies refer to resources that are not desired: iam_polcy (declares dependencies)",
+		},
+		{
+			name:   "cycle",
+			deps:   `iam_policy: ["iam_attachment"], iam_attachment: ["primary_bucket", "iam_policy"]`,
+			errMsg: "dependencies contain a cycle: iam_attachment -> iam_policy -> iam_attachment",
+		},
+		{
+			name:   "self",
+			deps:   `primary_bucket: ["primary_bucket"]`,
+			errMsg: "dependencies contain a cycle: primary_bucket -> primary_bucket",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			script := `
+response: desired: resources: {
+	primary_bucket: resource: kind: "Bucket"
+	iam_policy: resource: kind:     "Policy"
+	iam_attachment: resource: kind: "Attachment"
+}
+response: dependencies: {` + test.deps + `}
+`
+			var req fnv1.RunFunctionRequest
+			err := protojson.Unmarshal([]byte(`{
+				"observed": {
+					"composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } }
+				}
+			}`), &req)
+			require.NoError(t, err)
+			req.Input = makeInput(t, input.CueInput{Script: script})
+			f, err := New(Options{})
+			require.NoError(t, err)
+			res, err := f.RunFunction(context.Background(), &req)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errMsg)
+			require.Len(t, res.GetResults(), 1)
+			assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+		})
+	}
+}
+
+func TestSplitExtensions(t *testing.T) {
+	b, ext, err := splitExtensions([]byte(`{"desired":{},"dependencies":{"a":["b"]}}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"desired":{}}`, string(b))
+	assert.Equal(t, map[string][]string{"a": {"b"}}, ext.Dependencies)
+
+	_, _, err = splitExtensions([]byte(`{"dependencies":{"a":"b"}}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,92 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+	"github.com/pkg/errors"
+)
+
+// detectDrift returns the paths of fields of desired resources that differ from their observed state, keyed by
+// resource name. Resources that have not been observed yet are not included.
+func detectDrift(observed, desired *fnv1.State) map[string][]string {
+	ret := map[string][]string{}
+	for name, d := range desired.GetResources() {
+		o, ok := observed.GetResources()[name]
+		if !ok {
+			continue
+		}
+		if fields := resourceFieldDiffs(o, d, false); len(fields) > 0 {
+			ret[name] = fields
+		}
+	}
+	return ret
+}
+
+// driftMessage returns a human-readable message for the supplied drift.
+func driftMessage(drift map[string][]string) string {
+	names := make([]string, 0, len(drift))
+	for name := range drift {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s (%s)", name, strings.Join(drift[name], ", ")))
+	}
+	return "desired fields differ from observed for resources: " + strings.Join(parts, "; ")
+}
+
+// reportDrift reports drift between the desired resources in the response and the observed resources in
+// the request as specified.
+func (f *Cue) reportDrift(req *fnv1.RunFunctionRequest, res *fnv1.RunFunctionResponse, report input.DriftReport,
+	opts EvalOptions,
+) {
+	if report == "" || report == input.DriftReportNone {
+		return
+	}
+	drift := detectDrift(req.GetObserved(), res.GetDesired())
+	if len(drift) == 0 {
+		return
+	}
+	if report == input.DriftReportWarning {
+		response.Warning(res, errors.New(driftMessage(drift)))
+		return
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = f.log
+	}
+	b, err := json.Marshal(drift)
+	if err != nil {
+		logger.Info("unable to report drift", "error", err)
+		return
+	}
+	dbgFormat := opts.Debug.Format
+	if dbgFormat == "" {
+		dbgFormat = f.debugFormat
+	}
+	debugPayload(logger, dbgFormat, "drift", "", f.getFormattedDebugString(b, &debugFilter{raw: true}, dbgFormat))
+}
@@ -0,0 +1,104 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func makeDriftRequest(t *testing.T, report input.DriftReport) *fnv1.RunFunctionRequest {
+	var req fnv1.RunFunctionRequest
+	err := protojson.Unmarshal([]byte(`{
+		"observed": {
+			"composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } },
+			"resources": {
+				"main": { "resource": { "spec": { "region": "us-east-1", "size": 1, "zone": "a" } } },
+				"other": { "resource": { "foo": "bar" } }
+			}
+		}
+	}`), &req)
+	require.NoError(t, err)
+	req.Input = makeInput(t, input.CueInput{
+		Script: `
+response: desired: resources: {
+	main: resource: spec: { region: "us-west-2", size: 1, tags: ["a"] }
+	other: resource: foo: "bar"
+	pending: resource: foo: "baz"
+}
+`,
+		DriftReport: report,
+	})
+	return &req
+}
+
+func TestDriftReportWarning(t *testing.T) {
+	f, err := New(Options{})
+	require.NoError(t, err)
+	res, err := f.RunFunction(context.Background(), makeDriftRequest(t, input.DriftReportWarning))
+	require.NoError(t, err)
+	require.Len(t, res.GetResults(), 2)
+	assert.Equal(t, fnv1.Severity_SEVERITY_WARNING, res.GetResults()[0].GetSeverity())
+	assert.Equal(t, "desired fields differ from observed for resources: main (spec.region, spec.tags)",
+		res.GetResults()[0].GetMessage())
+}
+
+func TestDriftReportDebug(t *testing.T) {
+	logger := newRecordingLogger()
+	f, err := New(Options{Logger: logger, DebugFormat: DebugFormatJSON})
+	require.NoError(t, err)
+	res, err := f.RunFunction(context.Background(), makeDriftRequest(t, input.DriftReportDebug))
+	require.NoError(t, err)
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_NORMAL, res.GetResults()[0].GetSeverity())
+
+	entries := logger.messages("cue debug output")
+	require.Len(t, entries, 1)
+	assert.Equal(t, "drift", entries[0].values["debug-phase"])
+	payload, ok := entries[0].values["debug-payload"].(string)
+	require.True(t, ok)
+	var drift map[string][]string
+	require.NoError(t, json.Unmarshal([]byte(payload), &drift))
+	assert.Equal(t, map[string][]string{"main": {"spec.region", "spec.tags"}}, drift)
+}
+
+func TestDriftReportNone(t *testing.T) {
+	f, err := New(Options{})
+	require.NoError(t, err)
+	res, err := f.RunFunction(context.Background(), makeDriftRequest(t, ""))
+	require.NoError(t, err)
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_NORMAL, res.GetResults()[0].GetSeverity())
+}
+
+func TestDriftReportInvalid(t *testing.T) {
+	f, err := New(Options{})
+	require.NoError(t, err)
+	res, err := f.RunFunction(context.Background(), makeDriftRequest(t, "Warning"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid driftReport "Warning", must be one of none, warning or debug`)
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+}
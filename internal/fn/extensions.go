@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// responseExtensions are fields that a script can add to its response in addition to the fields of
+// a RunFunctionResponse. They are removed from the response before it is unmarshalled.
+type responseExtensions struct {
+	// Dependencies has the names of the resources that a desired resource depends on, keyed by resource name.
+	Dependencies map[string][]string `json:"dependencies,omitempty"`
+	// Patches has patches for desired resources, keyed by resource name. They are applied when the response is
+	// merged and are not combined across scripts.
+	Patches map[string]resourcePatch `json:"patches,omitempty"`
+	// skipped has the reasons for leaving out desired resources that were not concrete, keyed by resource name.
+	// It is set by the function and not by the script.
+	skipped map[string]string
+}
+
+// extensionFields are the names of the fields of responseExtensions.
+var extensionFields = []string{"dependencies", "patches"}
+
+// merge adds the supplied extensions to the receiver, with the supplied extensions taking precedence.
+func (e *responseExtensions) merge(other *responseExtensions) {
+	if other == nil {
+		return
+	}
+	for name, deps := range other.Dependencies {
+		if e.Dependencies == nil {
+			e.Dependencies = map[string][]string{}
+		}
+		e.Dependencies[name] = deps
+	}
+	for name, reason := range other.skipped {
+		if e.skipped == nil {
+			e.skipped = map[string]string{}
+		}
+		e.skipped[name] = reason
+	}
+}
+
+// splitExtensions removes extension fields from the supplied response JSON and returns them separately.
+func splitExtensions(resBytes []byte) ([]byte, *responseExtensions, error) {
+	ext := &responseExtensions{}
+	var obj map[string]json.RawMessage
+	// leave it to the proto unmarshaler to report invalid responses
+	if err := json.Unmarshal(resBytes, &obj); err != nil {
+		return resBytes, ext, nil
+	}
+	extObj := map[string]json.RawMessage{}
+	for _, k := range extensionFields {
+		if v, ok := obj[k]; ok {
+			extObj[k] = v
+			delete(obj, k)
+		}
+	}
+	if len(extObj) == 0 {
+		return resBytes, ext, nil
+	}
+	b, err := json.Marshal(extObj)
+	if err != nil {
+		return nil, nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(ext); err != nil {
+		return nil, nil, errors.Wrap(err, "unmarshal response extensions")
+	}
+	resBytes, err = json.Marshal(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resBytes, ext, nil
+}
@@ -0,0 +1,208 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"strings"
+)
+
+const (
+	redactedValue  = "<redacted>"
+	credentialsKey = "credentials"
+)
+
+// pathPattern is a glob-style pattern for a path in an object, split into segments.
+// A segment can be a literal, can contain the wildcards `*` and `?` that match within a single segment,
+// or can be `**` which matches zero or more segments.
+type pathPattern []string
+
+// parsePathPattern parses a pattern of the form `a.b.*.c` into its segments. A literal dot in a segment
+// can be specified by escaping it as `\.`, for example `metadata.annotations.example\.com/secret`.
+func parsePathPattern(s string) pathPattern {
+	var ret pathPattern
+	var current strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '.':
+			current.WriteByte('.')
+			i++
+		case s[i] == '.':
+			ret = append(ret, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(s[i])
+		}
+	}
+	return append(ret, current.String())
+}
+
+// globMatch returns true if the supplied string matches the pattern that may contain `*` and `?` wildcards.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// matches returns true if the pattern matches the supplied path.
+func (p pathPattern) matches(path []string) bool {
+	if len(p) == 0 {
+		return len(path) == 0
+	}
+	if p[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if p[1:].matches(path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 || !globMatch(p[0], path[0]) {
+		return false
+	}
+	return p[1:].matches(path[1:])
+}
+
+// debugFilter determines the attributes that are removed or redacted in debug output, in addition to
+// the system attributes and connection details that are always processed unless raw output is requested.
+type debugFilter struct {
+	raw       bool            // do not remove system attributes and noise
+	drop      []pathPattern   // attributes to remove, ignored for raw output
+	redact    []pathPattern   // attributes whose values are redacted, even for raw output
+	resources map[string]bool // names of observed and desired resources to retain, all resources when empty
+}
+
+func parsePathPatterns(patterns []string) []pathPattern {
+	var ret []pathPattern
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p != "" {
+			ret = append(ret, parsePathPattern(p))
+		}
+	}
+	return ret
+}
+
+// newDebugFilter returns a filter that combines the drop and redact rules configured for the runner
+// with the ones in the supplied debug options.
+func (f *Cue) newDebugFilter(opts DebugOptions) *debugFilter {
+	ret := &debugFilter{
+		raw:    opts.Raw,
+		drop:   append(append([]pathPattern{}, f.filter.drop...), parsePathPatterns(opts.Drop)...),
+		redact: append(append([]pathPattern{}, f.filter.redact...), parsePathPatterns(opts.Redact)...),
+	}
+	if len(opts.Resources) > 0 {
+		ret.resources = map[string]bool{}
+		for _, r := range opts.Resources {
+			ret.resources[r] = true
+		}
+	}
+	return ret
+}
+
+// newRedactFilter returns a filter that only removes system attributes and redacts attributes as per the
+// redact rules of the runner and the supplied debug options, without dropping attributes or resources.
+func (f *Cue) newRedactFilter(opts DebugOptions) *debugFilter {
+	return &debugFilter{
+		redact: append(append([]pathPattern{}, f.filter.redact...), parsePathPatterns(opts.Redact)...),
+	}
+}
+
+// isResourceMap returns true if the supplied path is that of the resources in an observed or desired state.
+// The path of a state can be empty for legacy responses that only contain the desired state.
+func isResourceMap(path []string) bool {
+	switch len(path) {
+	case 1:
+		return path[0] == "resources"
+	case 2:
+		return (path[0] == "observed" || path[0] == "desired") && path[1] == "resources"
+	default:
+		return false
+	}
+}
+
+func anyMatch(patterns []pathPattern, path []string) bool {
+	for _, p := range patterns {
+		if p.matches(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply removes and redacts attributes in the supplied object in place. Credentials of a request are
+// always redacted.
+func (d *debugFilter) apply(input any) {
+	if m, ok := input.(map[string]any); ok {
+		if creds, ok := m[credentialsKey].(map[string]any); ok {
+			for k := range creds {
+				creds[k] = redactedValue
+			}
+		}
+	}
+	if !d.raw {
+		walkDelete(input, "", true)
+	}
+	if len(d.redact) == 0 && len(d.resources) == 0 && (d.raw || len(d.drop) == 0) {
+		return
+	}
+	d.walk(input, nil)
+}
+
+func (d *debugFilter) walk(input any, path []string) {
+	switch input := input.(type) {
+	case []any:
+		for _, v := range input {
+			d.walk(v, path)
+		}
+	case map[string]any:
+		resourceMap := d.resources != nil && isResourceMap(path)
+		for k, v := range input {
+			if resourceMap && !d.resources[k] {
+				delete(input, k)
+				continue
+			}
+			childPath := append(path[:len(path):len(path)], k)
+			if !d.raw && anyMatch(d.drop, childPath) {
+				delete(input, k)
+				continue
+			}
+			if anyMatch(d.redact, childPath) {
+				input[k] = redactedValue
+				continue
+			}
+			d.walk(v, childPath)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"spec.forProvider.password", "spec.forProvider.password", true},
+		{"spec.forProvider.password", "spec.forProvider", false},
+		{"spec.*.password", "spec.forProvider.password", true},
+		{"spec.*.pass*", "spec.forProvider.passwordSecret", true},
+		{"spec.*.pass?", "spec.forProvider.passwordSecret", false},
+		{"**.password", "password", true},
+		{"**.password", "observed.resources.db.resource.spec.forProvider.password", true},
+		{"observed.**.status", "observed.status", true},
+		{"observed.**.status", "desired.composite.resource.status", false},
+		{`**.annotations.example\.com/*`, "metadata.annotations.example.com/secret", false},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern+"~"+test.path, func(t *testing.T) {
+			assert.Equal(t, test.match, parsePathPattern(test.pattern).matches(strings.Split(test.path, ".")))
+		})
+	}
+	// keys with dots are only matched by escaped patterns
+	path := []string{"metadata", "annotations", "example.com/secret"}
+	assert.True(t, parsePathPattern(`**.annotations.example\.com/*`).matches(path))
+	assert.False(t, parsePathPattern(`**.annotations.example.com/*`).matches(path))
+}
+
+func TestDebugFilter(t *testing.T) {
+	f, err := New(Options{
+		DebugDrop:   []string{"**.status.atProvider"},
+		DebugRedact: []string{"context.secret"},
+	})
+	require.NoError(t, err)
+	in := `{
+		"observed": {"resources": {"db": {"resource": {
+			"metadata": {"name": "db", "uid": "xxx"},
+			"spec": {"forProvider": {"password": "s3cr3t", "region": "us-east-1"}},
+			"status": {"atProvider": {"arn": "foo"}, "conditions": [{"type": "Ready"}]}
+		}}}},
+		"context": {"secret": {"value": "foo"}, "other": "bar"}
+	}`
+	filter := f.newDebugFilter(DebugOptions{Redact: []string{"**.forProvider.password"}})
+	out, err := f.reserializeWith([]byte(in), filter)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"observed": {"resources": {"db": {"resource": {
+			"metadata": {"name": "db"},
+			"spec": {"forProvider": {"password": "<redacted>", "region": "us-east-1"}},
+			"status": {"conditions": [{"type": "Ready"}]}
+		}}}},
+		"context": {"secret": "<redacted>", "other": "bar"}
+	}`, string(out))
+
+	// raw output only keeps noise, redaction still applies
+	filter = f.newDebugFilter(DebugOptions{Raw: true, Redact: []string{"**.forProvider.password"}})
+	out, err = f.reserializeWith([]byte(in), filter)
+	require.NoError(t, err)
+	var obj map[string]any
+	require.NoError(t, json.Unmarshal(out, &obj))
+	assert.Contains(t, string(out), `"uid": "xxx"`)
+	assert.Contains(t, string(out), `"arn": "foo"`)
+	assert.Contains(t, string(out), `"password": "<redacted>"`)
+	assert.Contains(t, string(out), `"secret": "<redacted>"`)
+
+	// runner level rules are not affected by per-eval rules
+	assert.Len(t, f.filter.redact, 1)
+}
+
+func TestDebugRedactResponse(t *testing.T) {
+	logger := newRecordingLogger()
+	f, err := New(Options{Logger: logger, DebugFormat: DebugFormatJSON})
+	require.NoError(t, err)
+	script := `
+response: desired: resources: main: resource: spec: forProvider: password: "s3cr3t"
+`
+	_, err = f.Eval(makeRequest(t), script, EvalOptions{
+		RequestVar:  "#request",
+		ResponseVar: "response",
+		Debug:       DebugOptions{Enabled: true, Raw: true, Redact: []string{"**.password"}},
+	})
+	require.NoError(t, err)
+	entries := logger.messages("cue debug output")
+	require.Len(t, entries, 2)
+	assert.NotContains(t, entries[1].values["debug-payload"], "s3cr3t")
+	assert.Contains(t, entries[1].values["debug-payload"], redactedValue)
+}
+
+func TestDebugResources(t *testing.T) {
+	logger := newRecordingLogger()
+	f, err := New(Options{Logger: logger, DebugFormat: DebugFormatJSON})
+	require.NoError(t, err)
+	script := `
+response: desired: resources: {
+	main: resource: foo: "bar"
+	other: resource: foo: "baz"
+}
+`
+	req := makeRequest(t)
+	_, err = f.Eval(req, script, EvalOptions{
+		RequestVar:  "#request",
+		ResponseVar: "response",
+		Debug:       DebugOptions{Enabled: true, ResponseOnly: true, Resources: []string{"main"}},
+	})
+	require.NoError(t, err)
+	entries := logger.messages("cue debug output")
+	require.Len(t, entries, 1)
+	assert.Equal(t, "response", entries[0].values["debug-phase"])
+	payload, ok := entries[0].values["debug-payload"].(string)
+	require.True(t, ok)
+	assert.JSONEq(t, `{"desired":{"resources":{"main":{"resource":{"foo":"bar"}}}}}`, payload)
+
+	filter := f.newDebugFilter(DebugOptions{Resources: []string{"main"}})
+	out, err := f.reserializeWith([]byte(`{"resources":{"main":{},"other":{}}, "foo": {"resources": {"other": {}}}}`), filter)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"resources":{"main":{}}, "foo": {"resources": {"other": {}}}}`, string(out))
+}
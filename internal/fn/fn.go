@@ -19,37 +19,87 @@ package fn
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
-	"log"
+	"strings"
+	"time"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
 	"cuelang.org/go/cue/parser"
 
 	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	"github.com/crossplane-contrib/function-cue/internal/schema"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/function-sdk-go"
 	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
 	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/resource"
 	"github.com/crossplane/function-sdk-go/response"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
-const debugAnnotation = "cue.fn.crossplane.io/debug"
+// annotations on the composite that control debug output for that XR.
+const (
+	debugAnnotation             = "cue.fn.crossplane.io/debug"
+	debugRawAnnotation          = "cue.fn.crossplane.io/debug-raw"
+	debugScriptAnnotation       = "cue.fn.crossplane.io/debug-script"
+	debugResponseOnlyAnnotation = "cue.fn.crossplane.io/debug-response-only"
+	debugResourcesAnnotation    = "cue.fn.crossplane.io/debug-resources"
+	debugChangesAnnotation      = "cue.fn.crossplane.io/debug-changes"
+)
 
 // Options are options for the cue runner.
 type Options struct {
-	Logger logging.Logger
-	Debug  bool
+	Logger      logging.Logger
+	Debug       bool
+	DebugFormat DebugFormat // default format for debug output, defaults to cue
+	History     int         // number of recent evaluations to keep for the debug handler, 0 disables history
+	RecordDir   string      // directory to which requests and responses are recorded as test fixtures
+	RecordAll   bool        // record fixtures for all XRs instead of only those that have the record annotation
+	DebugDrop   []string    // path patterns of attributes to remove from debug output
+	DebugRedact []string    // path patterns of attributes to redact in debug output
+	Limits      Limits      // limits for responses, in addition to the ones in the input
+	// ResultCacheTTL is the time for which successful responses are cached by request, 0 disables the cache.
+	ResultCacheTTL time.Duration
+	// ResultCacheSize is the maximum number of cached responses, defaults to 10000.
+	ResultCacheSize int
+	// Registerer is used to register metrics, which are not exported when nil.
+	Registerer prometheus.Registerer
+	// EvalStats collects cue evaluation statistics for every evaluation.
+	EvalStats bool
+	// Policy restricts the scripts that are evaluated.
+	Policy Policy
+	// ScriptKey is the public key used to verify script signatures. Unsigned scripts are evaluated when nil.
+	ScriptKey ed25519.PublicKey
 }
 
+// defaultResultCacheSize is the maximum number of cached responses when not specified.
+const defaultResultCacheSize = 10000
+
 // Cue runs cue scripts that adhere to a specific interface.
 type Cue struct {
 	fnv1.UnimplementedFunctionRunnerServiceServer
-	log   logging.Logger
-	debug bool
+	log         logging.Logger
+	debug       bool
+	debugFormat DebugFormat
+	history     *history
+	recordDir   string
+	recordAll   bool
+	filter      debugFilter
+	lastGood    *lastGoodCache
+	limits      Limits
+	results     *resultCache
+	metrics     *metrics
+	inflight    singleflight.Group // deduplicates concurrent evaluations of identical requests
+	evalStats   bool
+	policy      Policy
+	scriptKey   ed25519.PublicKey
 }
 
 // New creates a cue runner.
@@ -61,83 +111,295 @@ func New(opts Options) (*Cue, error) {
 			return nil, err
 		}
 	}
-	return &Cue{
-		log:   opts.Logger,
-		debug: opts.Debug,
-	}, nil
+	debugFormat, err := ParseDebugFormat(string(opts.DebugFormat))
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Policy.validate(); err != nil {
+		return nil, err
+	}
+	ret := &Cue{
+		log:         opts.Logger,
+		debug:       opts.Debug,
+		debugFormat: debugFormat,
+		recordDir:   opts.RecordDir,
+		recordAll:   opts.RecordAll,
+		filter: debugFilter{
+			drop:   parsePathPatterns(opts.DebugDrop),
+			redact: parsePathPatterns(opts.DebugRedact),
+		},
+		lastGood:  newLastGoodCache(),
+		limits:    opts.Limits,
+		evalStats: opts.EvalStats,
+		policy:    opts.Policy,
+		scriptKey: opts.ScriptKey,
+	}
+	if opts.History > 0 {
+		ret.history = newHistory(opts.History)
+	}
+	if opts.ResultCacheTTL > 0 {
+		size := opts.ResultCacheSize
+		if size <= 0 {
+			size = defaultResultCacheSize
+		}
+		ret.results = newResultCache(opts.ResultCacheTTL, size)
+	}
+	reg := opts.Registerer
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+	ret.metrics, err = newMetrics(reg)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
 }
 
 // DebugOptions are per-eval debug options.
 type DebugOptions struct {
-	Enabled bool // enable input/ output debugging
-	Raw     bool // do not remove any "noise" attributes in the input object
-	Script  bool // render the final script as a debug output
+	Enabled bool        // enable input/ output debugging
+	Raw     bool        // do not remove any "noise" attributes in the input object
+	Script  bool        // render the final script as a debug output
+	Format  DebugFormat // format of debug output, defaults to the format the runner was created with
+	Drop    []string    // additional path patterns of attributes to remove from debug output
+	Redact  []string    // additional path patterns of attributes to redact in debug output
+	// ResponseOnly suppresses debug output for the request.
+	ResponseOnly bool
+	// Resources limits the observed and desired resources in debug output to the ones with the supplied names.
+	Resources []string
+	// Changes replaces the request and response in debug output with a summary of changes made by the step.
+	Changes bool
+}
+
+// applyDebugAnnotations updates the supplied debug options using the debug annotations of the composite.
+// The boolean annotations only take effect with the value "true" and all of them, except the one for
+// the script, enable debugging for the XR. The resources annotation enables debugging for any non-empty
+// value other than "false".
+func applyDebugAnnotations(annotations map[string]string, opts *DebugOptions) {
+	isTrue := func(name string) bool { return annotations[name] == "true" }
+	if isTrue(debugAnnotation) {
+		opts.Enabled = true
+	}
+	if isTrue(debugRawAnnotation) {
+		opts.Enabled = true
+		opts.Raw = true
+	}
+	if isTrue(debugScriptAnnotation) {
+		opts.Script = true
+	}
+	if isTrue(debugChangesAnnotation) {
+		opts.Enabled = true
+		opts.Changes = true
+	}
+	if isTrue(debugResponseOnlyAnnotation) {
+		opts.Enabled = true
+		opts.ResponseOnly = true
+	}
+	if v := annotations[debugResourcesAnnotation]; v != "" && v != "false" {
+		opts.Enabled = true
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				opts.Resources = append(opts.Resources, name)
+			}
+		}
+	}
+}
+
+// RequestFields select the optional fields of the function request that are made available to the script.
+type RequestFields struct {
+	Meta           bool // the request metadata with the step tag
+	ExtraResources bool // extra resources supplied by Crossplane
+	Credentials    bool // credentials, always redacted in debug output
+	Input          bool // the function input
+}
+
+// ParseRequestFields returns the request fields for the supplied field names.
+func ParseRequestFields(names []input.RequestField) (RequestFields, error) {
+	var ret RequestFields
+	for _, name := range names {
+		switch name {
+		case input.RequestFieldMeta:
+			ret.Meta = true
+		case input.RequestFieldExtraResources:
+			ret.ExtraResources = true
+		case input.RequestFieldCredentials:
+			ret.Credentials = true
+		case input.RequestFieldInput:
+			ret.Input = true
+		default:
+			return ret, fmt.Errorf("invalid request field %q, must be one of meta, extraResources, credentials or input", name)
+		}
+	}
+	return ret, nil
+}
+
+// scriptRequest returns the request as seen by a script, which only contains the properties documented in
+// the interface and the optional fields selected, not the whole object.
+func (r RequestFields) scriptRequest(in *fnv1.RunFunctionRequest) *fnv1.RunFunctionRequest {
+	req := &fnv1.RunFunctionRequest{
+		Observed: in.GetObserved(),
+		Desired:  in.GetDesired(),
+		Context:  in.GetContext(),
+	}
+	if r.Meta {
+		req.Meta = in.GetMeta()
+	}
+	if r.ExtraResources {
+		req.ExtraResources = in.GetExtraResources()
+	}
+	if r.Credentials {
+		req.Credentials = in.GetCredentials()
+	}
+	if r.Input {
+		req.Input = in.GetInput()
+	}
+	return req
 }
 
 type EvalOptions struct {
 	RequestVar          string
 	ResponseVar         string
+	RequestFields       RequestFields // optional request fields to make available to the script
 	DesiredOnlyResponse bool
+	Schema              bool       // unify the request and response with the definitions of the function protocol
+	Partial             bool       // leave out desired resources that are not concrete instead of failing
+	Stats               bool       // collect evaluation statistics for debug output and metrics
+	Budget              EvalBudget // fail when evaluation statistics exceed the budget
 	Debug               DebugOptions
+	Logger              logging.Logger // logger for debug output, defaults to the runner's logger
 }
 
 // Eval evaluates the supplied script with an additional script that includes the supplied request and returns the
 // response.
 func (f *Cue) Eval(in *fnv1.RunFunctionRequest, script string, opts EvalOptions) (*fnv1.RunFunctionResponse, error) {
-	// input request only contains properties as documented in the interface, not the whole object
-	req := &fnv1.RunFunctionRequest{
-		Observed: in.GetObserved(),
-		Desired:  in.GetDesired(),
-		Context:  in.GetContext(),
-	}
+	ret, _, err := f.eval(in, script, opts)
+	return ret, err
+}
+
+// eval is the same as Eval except that it also returns the extension fields of the response.
+func (f *Cue) eval(in *fnv1.RunFunctionRequest, script string, opts EvalOptions,
+) (*fnv1.RunFunctionResponse, *responseExtensions, error) {
+	req := opts.RequestFields.scriptRequest(in)
 	// extract request as object
 	reqBytes, err := protojson.MarshalOptions{Indent: "  "}.Marshal(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "proto json marshal")
+		return nil, nil, errors.Wrap(err, "proto json marshal")
 	}
 
-	preamble := fmt.Sprintf("%s: ", opts.RequestVar)
-	if opts.Debug.Enabled {
-		log.Printf("[request:begin]\n%s %s\n[request:end]\n", preamble, f.getDebugString(reqBytes, opts.Debug.Raw))
+	logger := opts.Logger
+	if logger == nil {
+		logger = f.log
+	}
+	dbgFormat := opts.Debug.Format
+	if dbgFormat == "" {
+		dbgFormat = f.debugFormat
+	}
+	filter := f.newDebugFilter(opts.Debug)
+	if opts.Debug.Enabled && !opts.Debug.ResponseOnly && !opts.Debug.Changes {
+		debugPayload(logger, dbgFormat, "request", opts.RequestVar, f.getFormattedDebugString(reqBytes, filter, dbgFormat))
 	}
 
-	finalScript := fmt.Sprintf("%s\n%s %s\n", script, preamble, reqBytes)
+	finalScript := fmt.Sprintf("%s\n%s: %s\n", script, opts.RequestVar, reqBytes)
 	if opts.Debug.Script {
-		log.Printf("[script:begin]\n%s\n[script:end]\n", finalScript)
+		scriptFormat := DebugFormatCue
+		if dbgFormat == DebugFormatText {
+			scriptFormat = DebugFormatText
+		}
+		debugScript := finalScript
+		if len(req.GetCredentials()) > 0 {
+			// never show credentials, even for raw output
+			redacted, err := f.reserializeWith(reqBytes, &debugFilter{raw: true})
+			if err != nil {
+				redacted = []byte(fmt.Sprintf("%q", redactedValue))
+			}
+			debugScript = fmt.Sprintf("%s\n%s: %s\n", script, opts.RequestVar, redacted)
+		}
+		debugPayload(logger, scriptFormat, "script", "", debugScript)
 	}
 
+	if err := f.policy.check(script); err != nil {
+		return nil, nil, err
+	}
 	runtime := cuecontext.New()
-	val := runtime.CompileBytes([]byte(finalScript))
-	if val.Err() != nil {
-		return nil, errors.Wrap(val.Err(), "compile cue code")
+	var defs cue.Value
+	if opts.Schema {
+		defs, err = schema.Compile(runtime)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	var val cue.Value
+	if opts.Stats || opts.Budget.isSet() {
+		// statistics are collected by evaluating the uncompiled script, since compiling it evaluates it
+		file, err := parser.ParseFile("", finalScript)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "compile cue code")
+		}
+		var fills []cue.Value
+		if opts.Schema {
+			fills = append(fills, runtime.CompileString("{}").
+				FillPath(cue.ParsePath(opts.RequestVar), defs.LookupPath(cue.ParsePath(schema.RequestDef))))
+		}
+		val, err = f.evalStatistics(runtime, file, fills, opts, logger, dbgFormat)
+		if err != nil {
+			return nil, nil, err
+		}
+		if val.Err() != nil {
+			return nil, nil, errors.Wrap(val.Err(), "compile cue code")
+		}
+	} else {
+		val = runtime.CompileBytes([]byte(finalScript))
+		if val.Err() != nil {
+			return nil, nil, errors.Wrap(val.Err(), "compile cue code")
+		}
+		if opts.Schema {
+			val = val.FillPath(cue.ParsePath(opts.RequestVar), defs.LookupPath(cue.ParsePath(schema.RequestDef)))
+			if val.Err() != nil {
+				return nil, nil, errors.Wrap(val.Err(), "unify request with schema")
+			}
+		}
 	}
 
 	if opts.ResponseVar != "" {
 		e, err := parser.ParseExpr("expression", opts.ResponseVar)
 		if err != nil {
-			return nil, errors.Wrap(err, "parse response expression")
+			return nil, nil, errors.Wrap(err, "parse response expression")
 		}
 		val = val.Context().BuildExpr(e,
 			cue.Scope(val),
 			cue.InferBuiltins(true),
 		)
 		if val.Err() != nil {
-			return nil, errors.Wrap(val.Err(), "build response expression")
+			return nil, nil, errors.Wrap(val.Err(), "build response expression")
 		}
 	}
 
+	if opts.Schema && !opts.DesiredOnlyResponse {
+		val = val.Unify(defs.LookupPath(cue.ParsePath(schema.ResponseDef)))
+	}
 	resBytes, err := val.MarshalJSON() // this can fail if value is not concrete
+	var skipped map[string]string
+	if err != nil && opts.Partial {
+		path := []string{"desired", "resources"}
+		if opts.DesiredOnlyResponse {
+			path = []string{"resources"}
+		}
+		resBytes, skipped, err = marshalPartial(val, path)
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "marshal cue output")
+		return nil, nil, errors.Wrap(err, "marshal cue output")
 	}
-	if opts.Debug.Enabled {
-		preamble = ""
-		if opts.ResponseVar != "" {
-			preamble = opts.ResponseVar + ":"
-		}
-		log.Printf("[response:begin]\n%s %s\n[response:end]\n", preamble, f.getDebugString(resBytes, opts.Debug.Raw))
+	if opts.Debug.Enabled && !opts.Debug.Changes {
+		debugPayload(logger, dbgFormat, "response", opts.ResponseVar, f.getFormattedDebugString(resBytes, filter, dbgFormat))
 	}
 
+	ext := &responseExtensions{}
+	if !opts.DesiredOnlyResponse {
+		resBytes, ext, err = splitExtensions(resBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 	var ret fnv1.RunFunctionResponse
 	if opts.DesiredOnlyResponse {
 		var state fnv1.State
@@ -149,20 +411,64 @@ func (f *Cue) Eval(in *fnv1.RunFunctionRequest, script string, opts EvalOptions)
 		err = protojson.Unmarshal(resBytes, &ret)
 	}
 	if err != nil {
-		return nil, errors.Wrap(err, "unmarshal cue output using proto json")
+		return nil, nil, errors.Wrap(err, "unmarshal cue output using proto json")
 	}
-	return &ret, nil
+	ext.skipped = skipped
+	return &ret, ext, nil
 }
 
 // RunFunction runs the function. It expects a single script that is complete, except for a request
-// variable that the function runner supplies.
-func (f *Cue) RunFunction(_ context.Context, req *fnv1.RunFunctionRequest) (outRes *fnv1.RunFunctionResponse, finalErr error) {
+// variable that the function runner supplies. Concurrent requests that only differ in system attributes
+// share a single evaluation and, when the result cache is enabled, successful responses without debug
+// output or fixtures are returned from the cache for such requests.
+func (f *Cue) RunFunction(ctx context.Context, req *fnv1.RunFunctionRequest) (*fnv1.RunFunctionResponse, error) {
+	key, err := requestHash(req)
+	if err != nil {
+		f.log.Info("unable to hash request, evaluating without cache or deduplication", "error", err)
+		res, _, err := f.runFunction(ctx, req)
+		return res, err
+	}
+	if f.results != nil {
+		if res, ok := f.results.get(key); ok {
+			f.metrics.cacheHits.Inc()
+			return res, nil
+		}
+		f.metrics.cacheMisses.Inc()
+	}
+	v, err, shared := f.inflight.Do(key, func() (any, error) {
+		res, cacheable, err := f.runFunction(ctx, req)
+		if err == nil && cacheable && f.results != nil {
+			f.results.put(key, res)
+			f.metrics.cacheEntries.Set(float64(f.results.len()))
+		}
+		return res, err
+	})
+	res, _ := v.(*fnv1.RunFunctionResponse)
+	if shared && res != nil {
+		// every caller that shared the evaluation gets its own copy of the response
+		res, _ = proto.Clone(res).(*fnv1.RunFunctionResponse)
+	}
+	return res, err
+}
+
+// runFunction runs the function for the supplied request without consulting the result cache or
+// deduplicating concurrent requests. It also returns whether a successful response may be cached, which is
+// not the case when a cache hit would skip debug output or fixtures, or when the response was recovered
+// from an error.
+func (f *Cue) runFunction(_ context.Context, req *fnv1.RunFunctionRequest) (outRes *fnv1.RunFunctionResponse,
+	cacheable bool, finalErr error,
+) {
 	// setup response with desired state set up upstream functions
 	res := response.To(req, response.DefaultTTL)
 
 	logger := f.log
+	// set when the response was recovered from a script error as per the error policy
+	recovered := false
 	// automatically handle errors and response logging
 	defer func() {
+		if finalErr == nil && recovered {
+			return
+		}
 		if finalErr == nil {
 			logger.Info("cue module executed successfully")
 			response.Normal(outRes, "cue module executed successfully")
@@ -176,7 +482,7 @@ func (f *Cue) RunFunction(_ context.Context, req *fnv1.RunFunctionRequest) (outR
 	// setup logging and debugging
 	oxr, err := request.GetObservedCompositeResource(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "get observed composite")
+		return nil, false, errors.Wrap(err, "get observed composite")
 	}
 	tag := req.GetMeta().GetTag()
 	if tag != "" {
@@ -188,23 +494,60 @@ func (f *Cue) RunFunction(_ context.Context, req *fnv1.RunFunctionRequest) (outR
 		"xr-name", oxr.Resource.GetName(),
 	)
 	logger.Info("Running Function")
-	debugThis := false
-	annotations := oxr.Resource.GetAnnotations()
-	if annotations != nil && annotations[debugAnnotation] == "true" {
-		debugThis = true
-	}
 
 	// get inputs
 	in := &input.CueInput{}
 	if err := request.GetInput(req, in); err != nil {
-		return nil, errors.Wrap(err, "unable to get input")
+		return nil, false, errors.Wrap(err, "unable to get input")
 	}
-	if in.Script == "" {
-		return nil, fmt.Errorf("input script was not specified")
+	if err := verifyScript(f.scriptKey, in); err != nil {
+		return nil, false, errors.Wrap(err, "verify script")
 	}
-	if in.DebugNew {
-		if len(req.GetObserved().GetResources()) == 0 {
-			debugThis = true
+	route, err := selectRoute(oxr, in.Routes)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "select script route")
+	}
+	if route != nil {
+		in.Script, in.Scripts, in.Variants, in.ShadowScript = route.Script, route.Scripts, nil, ""
+		logger = logger.WithValues("script-route", routeName(*route))
+	}
+	var scripts []namedScript
+	switch {
+	case in.Script != "" && len(in.Scripts) > 0:
+		return nil, false, fmt.Errorf("only one of script and scripts can be specified")
+	case len(in.Scripts) > 0:
+		if len(in.Variants) > 0 || in.ShadowScript != "" {
+			return nil, false, fmt.Errorf("variants and shadowScript cannot be used with scripts")
+		}
+		scripts, err = namedScripts(in.Scripts)
+		if err != nil {
+			return nil, false, err
+		}
+	case in.Script == "" && len(in.Routes) > 0:
+		return nil, false, fmt.Errorf("no route matches %s and input script was not specified", oxr.Resource.GroupVersionKind())
+	case in.Script == "":
+		return nil, false, fmt.Errorf("input script was not specified")
+	default:
+		script := in.Script
+		variant, err := selectVariant(oxr, in.Variants)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "select script variant")
+		}
+		if variant != nil {
+			script = variant.Script
+			logger = logger.WithValues("script-variant", variant.Name)
+		}
+		scripts = []namedScript{{script: script}}
+	}
+	// policy violations are never recovered from as per the error policy, the scripts are not evaluated at all
+	if err := f.policy.checkScripts(scripts, in.ShadowScript); err != nil {
+		return nil, false, err
+	}
+	debugFormat := f.debugFormat
+	if in.DebugFormat != "" {
+		debugFormat, err = ParseDebugFormat(in.DebugFormat)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "parse debug format")
 		}
 	}
 	// set up the request and response variables
@@ -221,23 +564,161 @@ func (f *Cue) RunFunction(_ context.Context, req *fnv1.RunFunctionRequest) (outR
 	default:
 		responseVar = in.ResponseVar
 	}
-	state, err := f.Eval(req, in.Script, EvalOptions{
+	requestFields, err := ParseRequestFields(in.RequestFields)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "parse request fields")
+	}
+	evalOpts := EvalOptions{
 		RequestVar:          requestVar,
 		ResponseVar:         responseVar,
+		RequestFields:       requestFields,
+		Schema:              in.Schema,
+		Partial:             in.Partial,
+		Stats:               f.evalStats,
 		DesiredOnlyResponse: in.LegacyDesiredOnlyResponse,
 		Debug: DebugOptions{
-			Enabled: f.debug || in.Debug || debugThis,
+			Enabled: f.debug || in.Debug,
 			Raw:     in.DebugRaw,
 			Script:  in.DebugScript,
+			Format:  debugFormat,
+			Drop:    in.DebugDrop,
+			Redact:  in.DebugRedact,
+			Changes: in.DebugChanges,
 		},
-	})
-	if err != nil {
-		return res, errors.Wrap(err, "eval script")
+		Logger: logger,
+	}
+	if in.EvalBudget != nil {
+		evalOpts.Budget = EvalBudget{
+			MaxUnifications: in.EvalBudget.MaxUnifications,
+			MaxDisjuncts:    in.EvalBudget.MaxDisjuncts,
+			MaxConjuncts:    in.EvalBudget.MaxConjuncts,
+		}
+	}
+	if in.DebugNew && len(req.GetObserved().GetResources()) == 0 {
+		evalOpts.Debug.Enabled = true
+	}
+	applyDebugAnnotations(oxr.Resource.GetAnnotations(), &evalOpts.Debug)
+	onError := in.OnError
+	switch onError {
+	case "":
+		onError = input.OnErrorFatal
+	case input.OnErrorFatal, input.OnErrorWarn, input.OnErrorLastKnownGood:
+	default:
+		return nil, false, fmt.Errorf("invalid onError policy %q, must be one of fatal, warn or lastKnownGood", onError)
+	}
+	switch in.DriftReport {
+	case "", input.DriftReportNone, input.DriftReportWarning, input.DriftReportDebug:
+	default:
+		return nil, false, fmt.Errorf("invalid driftReport %q, must be one of none, warning or debug", in.DriftReport)
+	}
+	// the response shares the desired state of the request, keep a copy of the upstream state to fall back to
+	// on errors and to record in the history
+	upstream, _ := proto.Clone(req.GetDesired()).(*fnv1.State)
+	script := combinedScript(scripts)
+	goodKey := lastGoodKey(string(oxr.Resource.GetUID()), script)
+	start := time.Now()
+	res, outputs, ext, err := f.evalScripts(oxr, req, res, scripts, in.ShadowScript, evalOpts)
+	if err == nil {
+		err = errors.Wrap(f.limits.withInput(in.Limits).check(res), "check limits")
+		if err != nil {
+			// do not send the runaway output back with the error
+			res = response.To(req, response.DefaultTTL)
+			res.Desired, _ = proto.Clone(upstream).(*fnv1.State)
+		}
+	}
+	// changes to immutable fields are never recovered from as per the error policy, since falling back to
+	// the upstream desired state would delete the protected resources
+	unrecoverable := false
+	if err == nil {
+		err = checkImmutable(req.GetObserved(), res.GetDesired(), in.ImmutableFields)
+		unrecoverable = err != nil
+	}
+	if err == nil && len(ext.skipped) > 0 {
+		err = checkSkipped(req.GetObserved(), ext.skipped)
+		if err == nil {
+			response.Normal(res, skippedMessage(ext.skipped))
+		}
+	}
+	if err == nil && len(ext.Dependencies) > 0 {
+		err = checkDependencies(res.GetDesired(), ext.Dependencies)
 	}
-	return f.mergeResponse(res, state)
+	var waiting map[string][]string
+	if err == nil && len(ext.Dependencies) > 0 {
+		waiting = holdBackResources(req.GetObserved(), res.GetDesired(), ext.Dependencies)
+		if len(waiting) > 0 {
+			response.Normal(res, waitingMessage(waiting))
+		}
+	}
+	if err == nil && in.AutoReady {
+		var names []string
+		for _, output := range outputs {
+			for name := range output.response.GetDesired().GetResources() {
+				names = append(names, name)
+			}
+		}
+		setAutoReady(req.GetObserved(), res.GetDesired(), names)
+		if in.AutoReadyComposite {
+			setCompositeReady(res.GetDesired(), len(waiting) > 0)
+		}
+	}
+	if err == nil {
+		f.reportDrift(req, res, in.DriftReport, evalOpts)
+		if onError == input.OnErrorLastKnownGood {
+			f.lastGood.put(goodKey, outputs, ext.Dependencies)
+		}
+	}
+	f.recordEvaluation(oxr, req, upstream, script, evalOpts, res, time.Since(start), err)
+	if err != nil && onError != input.OnErrorFatal && !unrecoverable {
+		recoveredRes, recoverErr := f.recoverFromError(req, upstream, onError, goodKey, err)
+		if recoverErr != nil {
+			return res, false, recoverErr
+		}
+		recovered = true
+		logger.Info("recovered from script error", "on-error", string(onError), "error", err.Error())
+		return recoveredRes, false, nil
+	}
+	cacheable = !evalOpts.Debug.Enabled && !evalOpts.Debug.Script && in.DriftReport != input.DriftReportDebug &&
+		!f.recording(oxr)
+	return res, cacheable, err
+}
+
+// recordEvaluation adds the evaluation of the script for the supplied request, with the supplied upstream desired
+// state, to the history, if enabled.
+func (f *Cue) recordEvaluation(oxr *resource.Composite, req *fnv1.RunFunctionRequest, upstream *fnv1.State,
+	script string, opts EvalOptions, res *fnv1.RunFunctionResponse, duration time.Duration, evalErr error,
+) {
+	if f.history == nil {
+		return
+	}
+	dbg := opts.Debug
+	dbg.Raw = false
+	filter := f.newDebugFilter(dbg)
+	e := Evaluation{
+		Time:       time.Now(),
+		XR:         oxr.Resource.GetKind() + "/" + oxr.Resource.GetName(),
+		APIVersion: oxr.Resource.GetAPIVersion(),
+		Tag:        req.GetMeta().GetTag(),
+		ScriptHash: scriptHash(script),
+		Duration:   duration.String(),
+	}
+	scriptReq := opts.RequestFields.scriptRequest(req)
+	scriptReq.Desired = upstream
+	reqBytes, err := protojson.Marshal(scriptReq)
+	if err == nil {
+		e.Request = f.getFormattedDebugString(reqBytes, filter, DebugFormatCue)
+	}
+	if evalErr != nil {
+		e.Error = evalErr.Error()
+	} else if resBytes, err := protojson.Marshal(res); err == nil {
+		e.Response = f.getFormattedDebugString(resBytes, filter, DebugFormatCue)
+	}
+	f.history.add(e)
 }
 
-func (f *Cue) mergeResponse(res *fnv1.RunFunctionResponse, cueResponse *fnv1.RunFunctionResponse) (*fnv1.RunFunctionResponse, error) {
+// mergeResponse merges the response of a script, along with the patches it returned, into the supplied response.
+func (f *Cue) mergeResponse(res *fnv1.RunFunctionResponse, cueResponse *fnv1.RunFunctionResponse,
+	patches map[string]resourcePatch,
+) (*fnv1.RunFunctionResponse, error) {
 	// selectively add returned resources without deleting any previous desired state
 	if res.Desired == nil {
 		res.Desired = &fnv1.State{}
@@ -254,6 +735,10 @@ func (f *Cue) mergeResponse(res *fnv1.RunFunctionResponse, cueResponse *fnv1.Run
 	for k, v := range cueResponse.Desired.GetResources() {
 		res.Desired.Resources[k] = v
 	}
+	// patch desired resources, including ones from previous steps
+	if err := applyPatches(res.Desired, patches); err != nil {
+		return nil, err
+	}
 	// merge the context if cueResponse has something in it
 	if cueResponse.Context != nil {
 		ctxMap := map[string]interface{}{}
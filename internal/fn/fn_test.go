@@ -61,6 +61,15 @@ func makeRequest(t *testing.T) *fnv1.RunFunctionRequest {
 	return &req
 }
 
+func makeInput(t *testing.T, in input.CueInput) *structpb.Struct {
+	b, err := json.Marshal(in)
+	require.NoError(t, err)
+	var untyped structpb.Struct
+	err = protojson.Unmarshal(b, &untyped)
+	require.NoError(t, err)
+	return &untyped
+}
+
 func TestEval(t *testing.T) {
 	script := `
 package runtime
@@ -191,7 +200,7 @@ func TestMergeResponse(t *testing.T) {
 	var res fnv1.RunFunctionResponse
 	f, err := New(Options{})
 	require.NoError(t, err)
-	_, err = f.mergeResponse(&res, &cueRes)
+	_, err = f.mergeResponse(&res, &cueRes, nil)
 	require.NoError(t, err)
 	b, _ := protojson.Marshal(&res)
 	blanksRemoved := strings.ReplaceAll(string(b), " ", "")
@@ -242,7 +251,7 @@ func TestMergeResponseWithExisting(t *testing.T) {
 	require.NoError(t, err)
 	f, err := New(Options{})
 	require.NoError(t, err)
-	_, err = f.mergeResponse(&res, &cueRes)
+	_, err = f.mergeResponse(&res, &cueRes, nil)
 	require.NoError(t, err)
 	b, _ := protojson.Marshal(&res)
 	blanksRemoved := strings.ReplaceAll(string(b), " ", "")
@@ -259,25 +268,46 @@ response: desired: resources: main: resource: {
 	bar: "baz"
 }
 `
-	in := input.CueInput{
+	req.Input = makeInput(t, input.CueInput{
 		TypeMeta:   metav1.TypeMeta{APIVersion: "v1Aplha1", Kind: "Function"},
 		ObjectMeta: metav1.ObjectMeta{Name: "foobar"},
 		Script:     script,
 		Debug:      true,
-	}
-	b, err := json.Marshal(in)
-	require.NoError(t, err)
-	var untyped structpb.Struct
-	err = protojson.Unmarshal(b, &untyped)
-	require.NoError(t, err)
-	req.Input = &untyped
+	})
 
 	f, err := New(Options{Debug: true})
 	require.NoError(t, err)
 	res, err := f.RunFunction(context.Background(), req)
 	require.NoError(t, err)
-	b, err = protojson.Marshal(res)
+	b, err := protojson.Marshal(res)
 	require.NoError(t, err)
 	blanksRemoved := strings.ReplaceAll(string(b), " ", "")
 	assert.Equal(t, `{"meta":{"tag":"v1","ttl":"60s"},"desired":{"resources":{"main":{"resource":{"bar":"baz","foo":"bar"}}}},"results":[{"severity":"SEVERITY_NORMAL","message":"cuemoduleexecutedsuccessfully","target":"TARGET_COMPOSITE"}]}`, blanksRemoved)
 }
+
+func TestApplyDebugAnnotations(t *testing.T) {
+	var opts DebugOptions
+	applyDebugAnnotations(nil, &opts)
+	assert.Equal(t, DebugOptions{}, opts)
+
+	opts = DebugOptions{}
+	applyDebugAnnotations(map[string]string{debugScriptAnnotation: "true"}, &opts)
+	assert.Equal(t, DebugOptions{Script: true}, opts)
+
+	opts = DebugOptions{}
+	applyDebugAnnotations(map[string]string{
+		debugRawAnnotation:          "true",
+		debugResponseOnlyAnnotation: "true",
+		debugResourcesAnnotation:    "primary_bucket, iam_policy",
+	}, &opts)
+	assert.Equal(t, DebugOptions{
+		Enabled:      true,
+		Raw:          true,
+		ResponseOnly: true,
+		Resources:    []string{"primary_bucket", "iam_policy"},
+	}, opts)
+
+	opts = DebugOptions{}
+	applyDebugAnnotations(map[string]string{debugAnnotation: "false", debugResourcesAnnotation: "false"}, &opts)
+	assert.Equal(t, DebugOptions{}, opts)
+}
@@ -0,0 +1,178 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Evaluation is the record of a single script evaluation kept for debugging purposes.
+type Evaluation struct {
+	ID         uint64    `json:"id"`
+	Time       time.Time `json:"time"`
+	XR         string    `json:"xr"` // kind/name of the composite
+	APIVersion string    `json:"apiVersion"`
+	Tag        string    `json:"tag,omitempty"`
+	ScriptHash string    `json:"scriptHash"`
+	Duration   string    `json:"duration"`
+	Error      string    `json:"error,omitempty"`
+	Request    string    `json:"request,omitempty"`  // redacted request in cue format
+	Response   string    `json:"response,omitempty"` // response in cue format
+}
+
+// summary returns a copy of the evaluation without the request and response payloads.
+func (e Evaluation) summary() Evaluation {
+	e.Request = ""
+	e.Response = ""
+	return e
+}
+
+// xrSummary provides a summary of evaluations for a single XR.
+type xrSummary struct {
+	XR          string    `json:"xr"`
+	Evaluations int       `json:"evaluations"`
+	Errors      int       `json:"errors"`
+	Last        time.Time `json:"last"`
+}
+
+// history is a bounded ring buffer of recent evaluations.
+type history struct {
+	l       sync.Mutex
+	entries []Evaluation
+	next    int
+	lastID  uint64
+}
+
+func newHistory(size int) *history {
+	return &history{entries: make([]Evaluation, 0, size)}
+}
+
+// add adds the supplied evaluation to the history, evicting the oldest one if the buffer is full.
+func (h *history) add(e Evaluation) {
+	h.l.Lock()
+	defer h.l.Unlock()
+	h.lastID++
+	e.ID = h.lastID
+	if len(h.entries) < cap(h.entries) {
+		h.entries = append(h.entries, e)
+		return
+	}
+	h.entries[h.next] = e
+	h.next = (h.next + 1) % len(h.entries)
+}
+
+// list returns evaluations, newest first, optionally filtered to a specific XR.
+func (h *history) list(xr string) []Evaluation {
+	h.l.Lock()
+	defer h.l.Unlock()
+	ret := []Evaluation{}
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		e := h.entries[(h.next+i)%len(h.entries)]
+		if xr == "" || e.XR == xr {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// get returns the evaluation with the supplied ID.
+func (h *history) get(id uint64) (Evaluation, bool) {
+	h.l.Lock()
+	defer h.l.Unlock()
+	for _, e := range h.entries {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return Evaluation{}, false
+}
+
+// scriptHash returns a hex-encoded sha256 hash of the supplied script.
+func scriptHash(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// DebugHandler returns an HTTP handler that allows browsing recent evaluations. It serves the following paths:
+//
+//	/xrs                - summary of evaluations for every XR in the history
+//	/evaluations        - evaluations without payloads, newest first, optionally filtered using an xr=kind/name query
+//	/evaluations/{id}   - a single evaluation including the request and response
+//
+// The handler returns a 404 status for all paths when history is not enabled.
+func (f *Cue) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	if f.history == nil {
+		return mux
+	}
+	mux.HandleFunc("GET /xrs", func(w http.ResponseWriter, _ *http.Request) {
+		summaries := map[string]*xrSummary{}
+		for _, e := range f.history.list("") {
+			s, ok := summaries[e.XR]
+			if !ok {
+				s = &xrSummary{XR: e.XR, Last: e.Time}
+				summaries[e.XR] = s
+			}
+			s.Evaluations++
+			if e.Error != "" {
+				s.Errors++
+			}
+		}
+		ret := make([]*xrSummary, 0, len(summaries))
+		for _, s := range summaries {
+			ret = append(ret, s)
+		}
+		sort.Slice(ret, func(i, j int) bool { return ret[i].XR < ret[j].XR })
+		writeJSON(w, ret)
+	})
+	mux.HandleFunc("GET /evaluations", func(w http.ResponseWriter, r *http.Request) {
+		entries := f.history.list(r.URL.Query().Get("xr"))
+		for i := range entries {
+			entries[i] = entries[i].summary()
+		}
+		writeJSON(w, entries)
+	})
+	mux.HandleFunc("GET /evaluations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid evaluation id", http.StatusBadRequest)
+			return
+		}
+		e, ok := f.history.get(id)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, e)
+	})
+	return mux
+}
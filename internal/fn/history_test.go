@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestHistoryRingBuffer(t *testing.T) {
+	h := newHistory(3)
+	for i := 0; i < 5; i++ {
+		h.add(Evaluation{XR: fmt.Sprintf("Kind/xr%d", i%2)})
+	}
+	all := h.list("")
+	require.Len(t, all, 3)
+	assert.EqualValues(t, 5, all[0].ID)
+	assert.EqualValues(t, 4, all[1].ID)
+	assert.EqualValues(t, 3, all[2].ID)
+
+	filtered := h.list("Kind/xr0")
+	require.Len(t, filtered, 2)
+	assert.EqualValues(t, 5, filtered[0].ID)
+	assert.EqualValues(t, 3, filtered[1].ID)
+
+	_, ok := h.get(1)
+	assert.False(t, ok)
+	e, ok := h.get(4)
+	require.True(t, ok)
+	assert.Equal(t, "Kind/xr1", e.XR)
+}
+
+func getJSON(t *testing.T, h http.Handler, path string, into any) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), into))
+	}
+	return rec.Code
+}
+
+func TestDebugHandler(t *testing.T) {
+	f, err := New(Options{History: 10})
+	require.NoError(t, err)
+	req := makeRequest(t)
+	req.Input = makeInput(t, input.CueInput{Script: `
+#request: {...}
+response: desired: resources: main: resource: foo: #request.observed.composite.resource.foo
+`})
+	_, err = f.RunFunction(context.Background(), req)
+	require.NoError(t, err)
+	req.Input = makeInput(t, input.CueInput{Script: `response: desired: resources: main: resource: foo: #request.no_such_thing`})
+	_, err = f.RunFunction(context.Background(), req)
+	require.Error(t, err)
+
+	h := f.DebugHandler()
+	var xrs []xrSummary
+	require.Equal(t, http.StatusOK, getJSON(t, h, "/xrs", &xrs))
+	require.Len(t, xrs, 1)
+	assert.Equal(t, "MyKind/", xrs[0].XR)
+	assert.Equal(t, 2, xrs[0].Evaluations)
+	assert.Equal(t, 1, xrs[0].Errors)
+
+	var list []Evaluation
+	require.Equal(t, http.StatusOK, getJSON(t, h, "/evaluations?xr=MyKind/", &list))
+	require.Len(t, list, 2)
+	assert.Contains(t, list[0].Error, "eval script")
+	assert.Empty(t, list[0].Request)
+	assert.Len(t, list[1].ScriptHash, 64)
+
+	var e Evaluation
+	require.Equal(t, http.StatusOK, getJSON(t, h, fmt.Sprintf("/evaluations/%d", list[1].ID), &e))
+	assert.Contains(t, e.Request, `foo:        "bar"`)
+	assert.Contains(t, e.Response, `resource: foo: "bar"`)
+	assert.Equal(t, http.StatusNotFound, getJSON(t, h, "/evaluations/100", &e))
+	assert.Equal(t, http.StatusBadRequest, getJSON(t, h, "/evaluations/foo", &e))
+
+	f, err = New(Options{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, getJSON(t, f.DebugHandler(), "/xrs", &xrs))
+}
+
+func TestHistoryRequestIsUpstream(t *testing.T) {
+	f, err := New(Options{History: 10})
+	require.NoError(t, err)
+	req := makeRequest(t)
+	req.Desired = &fnv1.State{Resources: map[string]*fnv1.Resource{
+		"upstream": {Resource: &structpb.Struct{Fields: map[string]*structpb.Value{"foo": structpb.NewStringValue("bar")}}},
+	}}
+	req.Input = makeInput(t, input.CueInput{Script: `response: desired: resources: fromscript: resource: foo: "baz"`})
+	res, err := f.RunFunction(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, res.GetDesired().GetResources(), "fromscript")
+
+	list := f.history.list("")
+	require.Len(t, list, 1)
+	assert.Contains(t, list[0].Request, "upstream")
+	assert.NotContains(t, list[0].Request, "fromscript")
+	assert.Contains(t, list[0].Response, "fromscript")
+}
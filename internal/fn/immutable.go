@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/pkg/errors"
+)
+
+// lookupField returns the value at the supplied path of an object and whether it exists.
+func lookupField(obj map[string]any, path []string) (any, bool) {
+	var current any = obj
+	for _, key := range path {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func jsonValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// checkImmutable returns an error that names every desired resource and field whose value differs from the
+// observed state at one of the supplied paths. Fields that are not set in either the observed or the desired
+// resource are not checked.
+func checkImmutable(observed, desired *fnv1.State, fields []string) error {
+	var names []string
+	var paths []pathPattern
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			names = append(names, f)
+			paths = append(paths, parsePathPattern(f))
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	var changes []string
+	for name, d := range desired.GetResources() {
+		o, ok := observed.GetResources()[name]
+		if !ok {
+			continue
+		}
+		oMap, dMap := o.GetResource().AsMap(), d.GetResource().AsMap()
+		for i, path := range paths {
+			oValue, ok := lookupField(oMap, path)
+			if !ok {
+				continue
+			}
+			dValue, ok := lookupField(dMap, path)
+			if !ok || reflect.DeepEqual(oValue, dValue) {
+				continue
+			}
+			changes = append(changes, fmt.Sprintf("%s (%s: %s -> %s)",
+				name, names[i], jsonValue(oValue), jsonValue(dValue)))
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	sort.Strings(changes)
+	return errors.Errorf("desired resources change immutable fields: %s", strings.Join(changes, "; "))
+}
@@ -0,0 +1,134 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestImmutableFields(t *testing.T) {
+	observed := `{
+		"composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } },
+		"resources": {
+			"bucket": { "resource": {
+				"metadata": { "name": "xr-bucket", "annotations": { "example.com/id": "1" } },
+				"spec": { "forProvider": { "region": "us-east-1" } }
+			} }
+		}
+	}`
+	tests := []struct {
+		name     string
+		script   string
+		observed string
+		onError  input.OnErrorPolicy
+		err      string
+	}{
+		{
+			name: "unchanged",
+			script: `
+response: desired: resources: bucket: resource: {
+	metadata: name: "xr-bucket"
+	spec: forProvider: {region: "us-east-1", versioning: true}
+}
+`,
+			observed: observed,
+		},
+		{
+			name: "not set in desired",
+			script: `
+response: desired: resources: bucket: resource: spec: forProvider: versioning: true
+`,
+			observed: observed,
+		},
+		{
+			name: "not observed yet",
+			script: `
+response: desired: resources: bucket: resource: spec: forProvider: region: "us-west-2"
+`,
+			observed: `{ "composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } } }`,
+		},
+		{
+			name: "changed",
+			script: `
+response: desired: resources: bucket: resource: {
+	metadata: name: "xr-bucket-2"
+	spec: forProvider: region: "us-west-2"
+}
+`,
+			observed: observed,
+			err: `desired resources change immutable fields: bucket (metadata.name: "xr-bucket" -> "xr-bucket-2"); ` +
+				`bucket (spec.forProvider.region: "us-east-1" -> "us-west-2")`,
+		},
+		{
+			name: "changed with onError warn",
+			script: `
+response: desired: resources: bucket: resource: spec: forProvider: region: "us-west-2"
+`,
+			observed: observed,
+			onError:  input.OnErrorWarn,
+			err:      `desired resources change immutable fields: bucket (spec.forProvider.region: "us-east-1" -> "us-west-2")`,
+		},
+		{
+			name: "changed with onError lastKnownGood",
+			script: `
+response: desired: resources: bucket: resource: spec: forProvider: region: "us-west-2"
+`,
+			observed: observed,
+			onError:  input.OnErrorLastKnownGood,
+			err:      `desired resources change immutable fields: bucket (spec.forProvider.region: "us-east-1" -> "us-west-2")`,
+		},
+		{
+			name: "escaped dot",
+			script: `
+response: desired: resources: bucket: resource: metadata: annotations: "example.com/id": "2"
+`,
+			observed: observed,
+			err:      `desired resources change immutable fields: bucket (metadata.annotations.example\.com/id: "1" -> "2")`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var req fnv1.RunFunctionRequest
+			err := protojson.Unmarshal([]byte(`{"observed": `+test.observed+`}`), &req)
+			require.NoError(t, err)
+			req.Input = makeInput(t, input.CueInput{
+				Script:          test.script,
+				ImmutableFields: []string{"metadata.name", "spec.forProvider.region", `metadata.annotations.example\.com/id`},
+				OnError:         test.onError,
+			})
+			f, err := New(Options{})
+			require.NoError(t, err)
+			res, err := f.RunFunction(context.Background(), &req)
+			if test.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, test.err, err.Error())
+			require.Len(t, res.GetResults(), 1)
+			assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// Limits constrain the response produced by the function. A limit of zero means no limit.
+type Limits struct {
+	MaxDesiredResources int // maximum number of desired resources
+	MaxResponseBytes    int // maximum size of the serialized response
+	MaxContextKeys      int // maximum number of context keys
+}
+
+// lowerLimit returns the lower of the supplied limits, where zero means no limit.
+func lowerLimit(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// withInput returns the limits that apply given the supplied limits from the input.
+func (l Limits) withInput(in *input.Limits) Limits {
+	if in == nil {
+		return l
+	}
+	return Limits{
+		MaxDesiredResources: lowerLimit(l.MaxDesiredResources, int(in.MaxDesiredResources)),
+		MaxResponseBytes:    lowerLimit(l.MaxResponseBytes, int(in.MaxResponseBytes)),
+		MaxContextKeys:      lowerLimit(l.MaxContextKeys, int(in.MaxContextKeys)),
+	}
+}
+
+// check returns an error if the supplied response exceeds any of the limits.
+func (l Limits) check(res *fnv1.RunFunctionResponse) error {
+	if n := len(res.GetDesired().GetResources()); l.MaxDesiredResources > 0 && n > l.MaxDesiredResources {
+		return errors.Errorf("response has %d desired resources, more than the limit of %d", n, l.MaxDesiredResources)
+	}
+	if n := len(res.GetContext().GetFields()); l.MaxContextKeys > 0 && n > l.MaxContextKeys {
+		return errors.Errorf("response has %d context keys, more than the limit of %d", n, l.MaxContextKeys)
+	}
+	if l.MaxResponseBytes > 0 {
+		if n := proto.Size(res); n > l.MaxResponseBytes {
+			return errors.Errorf("response has %d bytes, more than the limit of %d", n, l.MaxResponseBytes)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestLimits(t *testing.T) {
+	script := `
+response: desired: resources: {
+	for i in [1, 2, 3] {
+		"r\(i)": resource: foo: "bar"
+	}
+}
+response: context: { a: 1, b: 2 }
+`
+	tests := []struct {
+		name   string
+		server Limits
+		input  *input.Limits
+		err    string
+	}{
+		{
+			name: "unlimited",
+		},
+		{
+			name:   "within limits",
+			server: Limits{MaxDesiredResources: 3, MaxContextKeys: 2, MaxResponseBytes: 1000},
+		},
+		{
+			name:   "server resources",
+			server: Limits{MaxDesiredResources: 2},
+			err:    "check limits: response has 3 desired resources, more than the limit of 2",
+		},
+		{
+			name:   "input lower than server",
+			server: Limits{MaxContextKeys: 5},
+			input:  &input.Limits{MaxContextKeys: 1},
+			err:    "check limits: response has 2 context keys, more than the limit of 1",
+		},
+		{
+			name:   "input cannot raise server limit",
+			server: Limits{MaxDesiredResources: 2},
+			input:  &input.Limits{MaxDesiredResources: 10},
+			err:    "check limits: response has 3 desired resources, more than the limit of 2",
+		},
+		{
+			name:  "input bytes",
+			input: &input.Limits{MaxResponseBytes: 10},
+			err:   "more than the limit of 10",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := New(Options{Limits: test.server})
+			require.NoError(t, err)
+			req := makeRequest(t)
+			req.Input = makeInput(t, input.CueInput{Script: script, Limits: test.input})
+			res, err := f.RunFunction(context.Background(), req)
+			if test.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+			require.Len(t, res.GetResults(), 1)
+			assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+		})
+	}
+}
+
+func TestLimitsResponseOmitsOutput(t *testing.T) {
+	script := `
+response: desired: resources: {
+	for i in list.Range(0, 200, 1) {
+		"r\(i)": resource: foo: strings.Repeat("x", 50)
+	}
+}
+`
+	f, err := New(Options{Limits: Limits{MaxResponseBytes: 1000}})
+	require.NoError(t, err)
+	req := makeRequest(t)
+	req.Desired = &fnv1.State{Resources: map[string]*fnv1.Resource{
+		"upstream": {Resource: &structpb.Struct{Fields: map[string]*structpb.Value{"foo": structpb.NewStringValue("bar")}}},
+	}}
+	req.Input = makeInput(t, input.CueInput{Script: "import (\"list\"\n\"strings\")\n" + script})
+	res, err := f.RunFunction(context.Background(), req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "more than the limit of 1000")
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+	assert.Less(t, proto.Size(res), 1000)
+	assert.Len(t, res.GetDesired().GetResources(), 1)
+	assert.Contains(t, res.GetDesired().GetResources(), "upstream")
+}
@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics are the prometheus metrics of the function.
+type metrics struct {
+	cacheHits    prometheus.Counter
+	cacheMisses  prometheus.Counter
+	cacheEntries prometheus.Gauge
+	evalCounts   *prometheus.HistogramVec
+}
+
+// newMetrics creates the metrics of the function and registers them with the supplied registerer.
+func newMetrics(reg prometheus.Registerer) (*metrics, error) {
+	m := &metrics{
+		cacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "function_cue_result_cache_hits_total",
+			Help: "Number of requests served from the result cache.",
+		}),
+		cacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "function_cue_result_cache_misses_total",
+			Help: "Number of requests that were not found in the result cache.",
+		}),
+		cacheEntries: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "function_cue_result_cache_entries",
+			Help: "Number of entries in the result cache.",
+		}),
+		evalCounts: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "function_cue_eval_operations",
+			Help:    "Number of cue operations per evaluation of a script, for evaluations that collect statistics.",
+			Buckets: prometheus.ExponentialBuckets(100, 4, 10),
+		}, []string{"operation"}),
+	}
+	for _, c := range []prometheus.Collector{m.cacheHits, m.cacheMisses, m.cacheEntries, m.evalCounts} {
+		if err := reg.Register(c); err != nil {
+			return nil, errors.Wrap(err, "register metrics")
+		}
+	}
+	return m, nil
+}
+
+// observeEval records the supplied evaluation statistics.
+func (m *metrics) observeEval(s evalStats) {
+	m.evalCounts.WithLabelValues("unifications").Observe(float64(s.Unifications))
+	m.evalCounts.WithLabelValues("disjuncts").Observe(float64(s.Disjuncts))
+	m.evalCounts.WithLabelValues("conjuncts").Observe(float64(s.Conjuncts))
+}
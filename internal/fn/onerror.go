@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"sync"
+	"time"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxLastKnownGood is the maximum number of outputs kept for the last known good error policy.
+const maxLastKnownGood = 10000
+
+// lastGoodEntry is the last successful output of the scripts for an XR, along with the dependencies
+// between resources that the scripts declared.
+type lastGoodEntry struct {
+	time         time.Time
+	outputs      []scriptOutput
+	dependencies map[string][]string
+}
+
+// lastGoodCache holds the last successful output of scripts keyed by XR UID and script hash.
+type lastGoodCache struct {
+	l       sync.Mutex
+	entries map[string]lastGoodEntry
+}
+
+func newLastGoodCache() *lastGoodCache {
+	return &lastGoodCache{entries: map[string]lastGoodEntry{}}
+}
+
+func lastGoodKey(uid, script string) string {
+	return uid + "/" + scriptHash(script)
+}
+
+// put stores a copy of the supplied outputs and dependencies under the supplied key, evicting the oldest entry
+// when the cache is full.
+func (c *lastGoodCache) put(key string, outputs []scriptOutput, dependencies map[string][]string) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxLastKnownGood {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range c.entries {
+			if oldestKey == "" || e.time.Before(oldest) {
+				oldestKey, oldest = k, e.time
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+	e := lastGoodEntry{time: time.Now(), dependencies: dependencies}
+	for _, output := range outputs {
+		out, _ := proto.Clone(output.response).(*fnv1.RunFunctionResponse)
+		e.outputs = append(e.outputs, scriptOutput{response: out, patches: output.patches})
+	}
+	c.entries[key] = e
+}
+
+// get returns the entry for the supplied key.
+func (c *lastGoodCache) get(key string) (lastGoodEntry, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	e, ok := c.entries[key]
+	return e, ok
+}
+
+// recoverFromError returns a response for the supplied upstream desired state according to the supplied
+// error policy, given the error in evaluating the script. It returns an error when the policy does not allow
+// recovering from the error.
+func (f *Cue) recoverFromError(req *fnv1.RunFunctionRequest, upstream *fnv1.State, policy input.OnErrorPolicy,
+	key string, evalErr error,
+) (*fnv1.RunFunctionResponse, error) {
+	res := response.To(req, response.DefaultTTL)
+	res.Desired = upstream
+	switch policy {
+	case input.OnErrorWarn:
+		response.Warning(res, errors.Wrap(evalErr, "returning upstream desired state"))
+		return res, nil
+	case input.OnErrorLastKnownGood:
+		e, ok := f.lastGood.get(key)
+		if !ok {
+			return nil, errors.Wrap(evalErr, "no last known good output")
+		}
+		for _, output := range e.outputs {
+			merged, err := f.mergeResponse(res, output.response, output.patches)
+			if err != nil {
+				return nil, errors.Wrap(err, "merge last known good output")
+			}
+			res = merged
+		}
+		// resources held back until their dependencies are ready are held back by the last known good output too
+		if len(e.dependencies) > 0 {
+			if err := checkDependencies(res.GetDesired(), e.dependencies); err != nil {
+				return nil, errors.Wrap(err, "check last known good dependencies")
+			}
+			if waiting := holdBackResources(req.GetObserved(), res.GetDesired(), e.dependencies); len(waiting) > 0 {
+				response.Normal(res, waitingMessage(waiting))
+			}
+		}
+		response.Warning(res, errors.Wrapf(evalErr, "using last known good output from %s", e.time.UTC().Format(time.RFC3339)))
+		return res, nil
+	default:
+		return nil, evalErr
+	}
+}
@@ -0,0 +1,158 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// the script fails when the XR has a `fail` attribute.
+const onErrorScript = `
+#request: observed: composite: resource: {...}
+response: desired: resources: main: resource: {
+	if #request.observed.composite.resource.fail != _|_ {
+		foo: 1 & 2
+	}
+	foo: #request.observed.composite.resource.foo
+}
+`
+
+func makeOnErrorRequest(t *testing.T, policy input.OnErrorPolicy, foo string, fail bool) *fnv1.RunFunctionRequest {
+	var req fnv1.RunFunctionRequest
+	failAttr := ""
+	if fail {
+		failAttr = `, "fail": true`
+	}
+	err := protojson.Unmarshal([]byte(fmt.Sprintf(`{
+		"observed": {
+			"composite": { "resource": {
+				"apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr", "uid": "u1" }, "foo": %q %s
+			} }
+		},
+		"desired": {
+			"resources": { "upstream": { "resource": { "foo": "bar" } } }
+		}
+	}`, foo, failAttr)), &req)
+	require.NoError(t, err)
+	req.Input = makeInput(t, input.CueInput{Script: onErrorScript, OnError: policy})
+	return &req
+}
+
+func TestOnErrorFatal(t *testing.T) {
+	f, err := New(Options{})
+	require.NoError(t, err)
+	res, err := f.RunFunction(context.Background(), makeOnErrorRequest(t, "", "a", true))
+	require.Error(t, err)
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+}
+
+func TestOnErrorWarn(t *testing.T) {
+	f, err := New(Options{})
+	require.NoError(t, err)
+	res, err := f.RunFunction(context.Background(), makeOnErrorRequest(t, input.OnErrorWarn, "a", true))
+	require.NoError(t, err)
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_WARNING, res.GetResults()[0].GetSeverity())
+	assert.Contains(t, res.GetResults()[0].GetMessage(), "returning upstream desired state: eval script:")
+	assert.Len(t, res.GetDesired().GetResources(), 1)
+	assert.Contains(t, res.GetDesired().GetResources(), "upstream")
+}
+
+func TestOnErrorLastKnownGood(t *testing.T) {
+	f, err := New(Options{})
+	require.NoError(t, err)
+
+	// no output available yet
+	res, err := f.RunFunction(context.Background(), makeOnErrorRequest(t, input.OnErrorLastKnownGood, "a", true))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no last known good output")
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+
+	res, err = f.RunFunction(context.Background(), makeOnErrorRequest(t, input.OnErrorLastKnownGood, "a", false))
+	require.NoError(t, err)
+	require.Len(t, res.GetDesired().GetResources(), 2)
+
+	res, err = f.RunFunction(context.Background(), makeOnErrorRequest(t, input.OnErrorLastKnownGood, "b", true))
+	require.NoError(t, err)
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_WARNING, res.GetResults()[0].GetSeverity())
+	assert.Contains(t, res.GetResults()[0].GetMessage(), "using last known good output from")
+	require.Len(t, res.GetDesired().GetResources(), 2)
+	assert.Equal(t, "a", res.GetDesired().GetResources()["main"].GetResource().AsMap()["foo"])
+
+	// a different script does not reuse the output
+	req := makeOnErrorRequest(t, input.OnErrorLastKnownGood, "b", true)
+	req.Input = makeInput(t, input.CueInput{Script: onErrorScript + "\n// changed\n", OnError: input.OnErrorLastKnownGood})
+	_, err = f.RunFunction(context.Background(), req)
+	require.Error(t, err)
+}
+
+func TestOnErrorLastKnownGoodDependencies(t *testing.T) {
+	script := onErrorScript + `
+response: desired: resources: dependent: resource: foo: "bar"
+response: dependencies: dependent: ["main"]
+`
+	makeReq := func(fail bool) *fnv1.RunFunctionRequest {
+		req := makeOnErrorRequest(t, input.OnErrorLastKnownGood, "a", fail)
+		req.Input = makeInput(t, input.CueInput{Script: script, OnError: input.OnErrorLastKnownGood})
+		return req
+	}
+	f, err := New(Options{})
+	require.NoError(t, err)
+
+	res, err := f.RunFunction(context.Background(), makeReq(false))
+	require.NoError(t, err)
+	assert.NotContains(t, res.GetDesired().GetResources(), "dependent")
+
+	// the last known good output holds back the same resources
+	res, err = f.RunFunction(context.Background(), makeReq(true))
+	require.NoError(t, err)
+	assert.Len(t, res.GetDesired().GetResources(), 2)
+	assert.NotContains(t, res.GetDesired().GetResources(), "dependent")
+	require.Len(t, res.GetResults(), 2)
+	assert.Equal(t, "resources held back until their dependencies are ready: dependent waits for main",
+		res.GetResults()[0].GetMessage())
+	assert.Equal(t, fnv1.Severity_SEVERITY_WARNING, res.GetResults()[1].GetSeverity())
+
+	// and releases them once their dependencies are ready
+	req := makeReq(true)
+	req.Observed.Resources = map[string]*fnv1.Resource{"main": {Resource: req.GetDesired().GetResources()["upstream"].GetResource()}}
+	res, err = f.RunFunction(context.Background(), req)
+	require.NoError(t, err)
+	assert.Contains(t, res.GetDesired().GetResources(), "dependent")
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_WARNING, res.GetResults()[0].GetSeverity())
+}
+
+func TestOnErrorInvalid(t *testing.T) {
+	f, err := New(Options{})
+	require.NoError(t, err)
+	_, err = f.RunFunction(context.Background(), makeOnErrorRequest(t, "ignore", "a", false))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid onError policy "ignore"`)
+}
@@ -0,0 +1,110 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/pkg/errors"
+)
+
+// marshalPartial marshals the supplied value to JSON, leaving out the fields of the struct at the supplied path
+// that are not concrete. It returns the reasons for leaving out fields, keyed by field name.
+func marshalPartial(v cue.Value, path []string) ([]byte, map[string]string, error) {
+	skipped := map[string]string{}
+	if v.IncompleteKind() != cue.StructKind {
+		b, err := v.MarshalJSON()
+		return b, skipped, err
+	}
+	iter, err := v.Fields()
+	if err != nil {
+		return nil, nil, err
+	}
+	out := map[string]json.RawMessage{}
+	for iter.Next() {
+		name := iter.Selector().Unquoted()
+		switch {
+		case len(path) == 0:
+			// validation produces more concise errors than marshaling
+			if err := iter.Value().Validate(cue.Concrete(true)); err != nil {
+				skipped[name] = err.Error()
+				continue
+			}
+			b, err := iter.Value().MarshalJSON()
+			if err != nil {
+				skipped[name] = err.Error()
+				continue
+			}
+			out[name] = b
+		case name == path[0]:
+			b, s, err := marshalPartial(iter.Value(), path[1:])
+			if err != nil {
+				return nil, nil, err
+			}
+			out[name] = b
+			skipped = s
+		default:
+			b, err := iter.Value().MarshalJSON()
+			if err != nil {
+				return nil, nil, err
+			}
+			out[name] = b
+		}
+	}
+	b, err := json.Marshal(out)
+	return b, skipped, err
+}
+
+// checkSkipped returns an error if any of the supplied skipped resources have already been observed, since
+// leaving them out of the desired state would delete them.
+func checkSkipped(observed *fnv1.State, skipped map[string]string) error {
+	var existing []string
+	for name := range skipped {
+		if _, ok := observed.GetResources()[name]; ok {
+			existing = append(existing, name)
+		}
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+	sort.Strings(existing)
+	parts := make([]string, 0, len(existing))
+	for _, name := range existing {
+		parts = append(parts, fmt.Sprintf("%s: %s", name, skipped[name]))
+	}
+	return errors.Errorf("existing resources are not concrete: %s", strings.Join(parts, "; "))
+}
+
+// skippedMessage returns a human-readable message for the supplied skipped resources.
+func skippedMessage(skipped map[string]string) string {
+	names := make([]string, 0, len(skipped))
+	for name := range skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s (%s)", name, skipped[name]))
+	}
+	return "skipped desired resources that are not concrete: " + strings.Join(parts, "; ")
+}
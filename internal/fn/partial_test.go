@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const partialScript = `
+#request: {...}
+response: desired: resources: {
+	bucket: resource: name: "b"
+	policy: resource: bucketArn: string
+	if #request.observed.resources.bucket.resource.status.arn != _|_ {
+		policy: resource: bucketArn: #request.observed.resources.bucket.resource.status.arn
+	}
+	role: resource: name: string
+}
+response: context: "example.com/key": "value"
+`
+
+func TestPartial(t *testing.T) {
+	f, err := New(Options{})
+	require.NoError(t, err)
+
+	req := makeRequest(t)
+	req.Input = makeInput(t, input.CueInput{Script: partialScript})
+	_, err = f.RunFunction(context.Background(), req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "marshal cue output")
+
+	req = makeRequest(t)
+	req.Input = makeInput(t, input.CueInput{Script: partialScript, Partial: true})
+	res, err := f.RunFunction(context.Background(), req)
+	require.NoError(t, err)
+	assert.Len(t, res.GetDesired().GetResources(), 1)
+	assert.Contains(t, res.GetDesired().GetResources(), "bucket")
+	assert.Equal(t, "value", res.GetContext().AsMap()["example.com/key"])
+	require.Len(t, res.GetResults(), 2)
+	assert.Equal(t, fnv1.Severity_SEVERITY_NORMAL, res.GetResults()[0].GetSeverity())
+	msg := res.GetResults()[0].GetMessage()
+	assert.Contains(t, msg, "skipped desired resources that are not concrete: policy (")
+	assert.Contains(t, msg, "; role (")
+	assert.Contains(t, msg, "incomplete value string")
+}
+
+func TestPartialExisting(t *testing.T) {
+	var req fnv1.RunFunctionRequest
+	err := protojson.Unmarshal([]byte(`{
+		"observed": {
+			"composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } },
+			"resources": {
+				"bucket": { "resource": { "name": "b" } },
+				"role": { "resource": { "name": "r" } }
+			}
+		}
+	}`), &req)
+	require.NoError(t, err)
+	req.Input = makeInput(t, input.CueInput{Script: partialScript, Partial: true})
+	f, err := New(Options{})
+	require.NoError(t, err)
+	_, err = f.RunFunction(context.Background(), &req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "existing resources are not concrete: role:")
+}
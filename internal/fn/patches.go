@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"encoding/json"
+	"sort"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// resourcePatch is a patch for the object of a desired resource. When both patches are set, the merge patch
+// is applied first.
+type resourcePatch struct {
+	MergePatch json.RawMessage `json:"mergePatch,omitempty"` // RFC 7386 JSON merge patch
+	JSONPatch  json.RawMessage `json:"jsonPatch,omitempty"`  // RFC 6902 JSON patch
+}
+
+// apply returns the result of applying the patch to the supplied JSON document.
+func (p resourcePatch) apply(doc []byte) ([]byte, error) {
+	var err error
+	if len(p.MergePatch) > 0 {
+		doc, err = jsonpatch.MergePatch(doc, p.MergePatch)
+		if err != nil {
+			return nil, errors.Wrap(err, "apply merge patch")
+		}
+	}
+	if len(p.JSONPatch) > 0 {
+		patch, err := jsonpatch.DecodePatch(p.JSONPatch)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode json patch")
+		}
+		doc, err = patch.Apply(doc)
+		if err != nil {
+			return nil, errors.Wrap(err, "apply json patch")
+		}
+	}
+	return doc, nil
+}
+
+// applyPatches applies the supplied patches to the desired resources with matching names. The patched resources
+// are replaced such that resources shared with other messages are not modified.
+func applyPatches(desired *fnv1.State, patches map[string]resourcePatch) error {
+	names := make([]string, 0, len(patches))
+	for name := range patches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r, ok := desired.GetResources()[name]
+		if !ok {
+			return errors.Errorf("patch desired resource %q: resource not found", name)
+		}
+		doc, err := protojson.Marshal(r.GetResource())
+		if err != nil {
+			return errors.Wrapf(err, "patch desired resource %q", name)
+		}
+		doc, err = patches[name].apply(doc)
+		if err != nil {
+			return errors.Wrapf(err, "patch desired resource %q", name)
+		}
+		var s structpb.Struct
+		if err := protojson.Unmarshal(doc, &s); err != nil {
+			return errors.Wrapf(err, "patch desired resource %q", name)
+		}
+		patched, _ := proto.Clone(r).(*fnv1.Resource)
+		patched.Resource = &s
+		desired.Resources[name] = patched
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestPatches(t *testing.T) {
+	upstream := `{
+		"observed": {
+			"composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } }
+		},
+		"desired": {
+			"resources": {
+				"bucket": { "resource": { "kind": "Bucket", "metadata": { "labels": { "a": "1", "b": "2" } }, "spec": { "tags": ["x"] } } }
+			}
+		}
+	}`
+	tests := []struct {
+		name     string
+		script   string
+		expected string
+		err      string
+	}{
+		{
+			name: "merge patch",
+			script: `
+response: patches: bucket: mergePatch: metadata: labels: {a: null, c: "3"}
+`,
+			expected: `{ "kind": "Bucket", "metadata": { "labels": { "b": "2", "c": "3" } }, "spec": { "tags": ["x"] } }`,
+		},
+		{
+			name: "json patch",
+			script: `
+response: patches: bucket: jsonPatch: [
+	{op: "add", path: "/spec/tags/-", value: "y"},
+	{op: "remove", path: "/metadata/labels/b"},
+]
+`,
+			expected: `{ "kind": "Bucket", "metadata": { "labels": { "a": "1" } }, "spec": { "tags": ["x", "y"] } }`,
+		},
+		{
+			name: "both patches",
+			script: `
+response: patches: bucket: {
+	mergePatch: spec: tags: ["z"]
+	jsonPatch: [{op: "add", path: "/spec/tags/0", value: "w"}]
+}
+`,
+			expected: `{ "kind": "Bucket", "metadata": { "labels": { "a": "1", "b": "2" } }, "spec": { "tags": ["w", "z"] } }`,
+		},
+		{
+			name: "resource from the same script",
+			script: `
+response: desired: resources: bucket: resource: kind: "Bucket"
+response: patches: bucket: mergePatch: spec: size: 10
+`,
+			expected: `{ "kind": "Bucket", "spec": { "size": 10 } }`,
+		},
+		{
+			name: "unknown resource",
+			script: `
+response: patches: missing: mergePatch: spec: size: 10
+`,
+			err: `merge response: patch desired resource "missing": resource not found`,
+		},
+		{
+			name: "failed test operation",
+			script: `
+response: patches: bucket: jsonPatch: [{op: "test", path: "/kind", value: "Queue"}]
+`,
+			err: `patch desired resource "bucket": apply json patch`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var req fnv1.RunFunctionRequest
+			err := protojson.Unmarshal([]byte(upstream), &req)
+			require.NoError(t, err)
+			req.Input = makeInput(t, input.CueInput{Script: test.script})
+			f, err := New(Options{})
+			require.NoError(t, err)
+			res, err := f.RunFunction(context.Background(), &req)
+			if test.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			b, err := protojson.Marshal(res.GetDesired().GetResources()["bucket"].GetResource())
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(b))
+		})
+	}
+}
@@ -0,0 +1,197 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// Construct is a language construct that a policy can forbid.
+type Construct string
+
+// Constructs that a policy can forbid.
+const (
+	ConstructImport        Construct = "import"        // import declarations
+	ConstructComprehension Construct = "comprehension" // for and if comprehensions
+	ConstructDisjunction   Construct = "disjunction"   // disjunctions using |
+	ConstructDefault       Construct = "default"       // default values marked using *
+	ConstructLet           Construct = "let"           // let clauses
+	ConstructAttribute     Construct = "attribute"     // attributes such as @if or @tag
+	ConstructInterpolation Construct = "interpolation" // string interpolations
+)
+
+var constructs = []Construct{
+	ConstructImport, ConstructComprehension, ConstructDisjunction, ConstructDefault,
+	ConstructLet, ConstructAttribute, ConstructInterpolation,
+}
+
+// Policy restricts the scripts that the function evaluates. It is configured for the function server
+// such that platform teams can constrain scripts written by application teams.
+type Policy struct {
+	// AllowedImports are the import paths that scripts may use, for example `strings` or `encoding/*`.
+	// All imports are allowed when empty.
+	AllowedImports []string `json:"allowedImports,omitempty"`
+	// MaxScriptBytes is the maximum size of a script in bytes. Unlimited when 0.
+	MaxScriptBytes int `json:"maxScriptBytes,omitempty"`
+	// ForbiddenConstructs are the language constructs that scripts may not use.
+	ForbiddenConstructs []Construct `json:"forbiddenConstructs,omitempty"`
+}
+
+// LoadPolicy loads a policy from the supplied YAML or JSON file.
+func LoadPolicy(file string) (Policy, error) {
+	var p Policy
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return p, errors.Wrap(err, "read policy file")
+	}
+	b, err = yaml.YAMLToJSON(b)
+	if err != nil {
+		return p, errors.Wrapf(err, "parse policy file %s", file)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return p, errors.Wrapf(err, "parse policy file %s", file)
+	}
+	return p, p.validate()
+}
+
+// validate returns an error if the policy forbids unknown constructs.
+func (p Policy) validate() error {
+	for _, c := range p.ForbiddenConstructs {
+		known := false
+		for _, k := range constructs {
+			known = known || c == k
+		}
+		if !known {
+			names := make([]string, 0, len(constructs))
+			for _, k := range constructs {
+				names = append(names, string(k))
+			}
+			return fmt.Errorf("invalid forbidden construct %q, must be one of %s", c, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// isEmpty returns true if the policy does not restrict scripts.
+func (p Policy) isEmpty() bool {
+	return len(p.AllowedImports) == 0 && p.MaxScriptBytes == 0 && len(p.ForbiddenConstructs) == 0
+}
+
+// importAllowed returns true if the supplied import path is allowed.
+func (p Policy) importAllowed(path string) bool {
+	if len(p.AllowedImports) == 0 {
+		return true
+	}
+	for _, pattern := range p.AllowedImports {
+		if globMatch(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// constructOf returns the forbiddable construct that the supplied node is, if any.
+func constructOf(n ast.Node) (Construct, bool) {
+	switch n := n.(type) {
+	case *ast.ImportDecl:
+		return ConstructImport, true
+	case *ast.Comprehension:
+		return ConstructComprehension, true
+	case *ast.BinaryExpr:
+		return ConstructDisjunction, n.Op == token.OR
+	case *ast.UnaryExpr:
+		return ConstructDefault, n.Op == token.MUL
+	case *ast.LetClause:
+		return ConstructLet, true
+	case *ast.Attribute:
+		return ConstructAttribute, true
+	case *ast.Interpolation:
+		return ConstructInterpolation, true
+	default:
+		return "", false
+	}
+}
+
+// check returns an error that lists all violations of the policy by the supplied script. Scripts that cannot
+// be parsed are only checked for their size, such that the compiler reports syntax errors.
+func (p Policy) check(script string) error {
+	if p.isEmpty() {
+		return nil
+	}
+	if p.MaxScriptBytes > 0 && len(script) > p.MaxScriptBytes {
+		return errors.Errorf("policy violation: script has %d bytes, more than the limit of %d", len(script), p.MaxScriptBytes)
+	}
+	f, err := parser.ParseFile("script", script, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	forbidden := map[Construct]bool{}
+	for _, c := range p.ForbiddenConstructs {
+		forbidden[c] = true
+	}
+	var violations []string
+	add := func(pos token.Pos, msg string) {
+		violations = append(violations, fmt.Sprintf("%d:%d: %s", pos.Line(), pos.Column(), msg))
+	}
+	ast.Walk(f, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.ImportSpec); ok {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				path = spec.Path.Value
+			}
+			path, _, _ = strings.Cut(path, ":")
+			if !p.importAllowed(path) {
+				add(spec.Pos(), fmt.Sprintf("import %q is not allowed", path))
+			}
+		}
+		if c, ok := constructOf(n); ok && forbidden[c] {
+			add(n.Pos(), fmt.Sprintf("%s is forbidden", c))
+		}
+		return true
+	}, nil)
+	if len(violations) == 0 {
+		return nil
+	}
+	return errors.Errorf("policy violation: %s", strings.Join(violations, "; "))
+}
+
+// checkScripts returns an error if the supplied scripts or shadow script violate the policy.
+func (p Policy) checkScripts(scripts []namedScript, shadowScript string) error {
+	for _, s := range scripts {
+		if err := p.check(s.script); err != nil {
+			if s.name != "" {
+				return errors.Wrapf(err, "script %q", s.name)
+			}
+			return err
+		}
+	}
+	return errors.Wrap(p.check(shadowScript), "shadow script")
+}
@@ -0,0 +1,186 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	script := `import (
+	"strings"
+	"encoding/json"
+	"net"
+)
+
+let name = strings.ToUpper("x")
+a: *1 | int
+b: "\(name)" @tag(b)
+c: [for x in [1, 2] {x}]
+`
+	tests := []struct {
+		name   string
+		policy Policy
+		err    string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "allowed imports",
+			policy: Policy{AllowedImports: []string{"strings", "encoding/*", "net"}},
+		},
+		{
+			name:   "disallowed import",
+			policy: Policy{AllowedImports: []string{"strings", "encoding/*"}},
+			err:    `policy violation: 4:2: import "net" is not allowed`,
+		},
+		{
+			name:   "script size",
+			policy: Policy{MaxScriptBytes: 10},
+			err:    "policy violation: script has 137 bytes, more than the limit of 10",
+		},
+		{
+			name: "forbidden constructs",
+			policy: Policy{ForbiddenConstructs: []Construct{
+				ConstructImport, ConstructLet, ConstructDisjunction, ConstructDefault,
+				ConstructInterpolation, ConstructAttribute, ConstructComprehension,
+			}},
+			err: "policy violation: 1:1: import is forbidden; 7:1: let is forbidden; 8:4: disjunction is forbidden; " +
+				"8:4: default is forbidden; 9:4: interpolation is forbidden; 9:14: attribute is forbidden; " +
+				"10:5: comprehension is forbidden",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.check(script)
+			if test.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, test.err, err.Error())
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	_, err := New(Options{Policy: Policy{ForbiddenConstructs: []Construct{"goto"}}})
+	require.Error(t, err)
+	assert.Equal(t, `invalid forbidden construct "goto", must be one of import, comprehension, disjunction, default, `+
+		`let, attribute, interpolation`, err.Error())
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "policy.yaml")
+	err := os.WriteFile(file, []byte("allowedImports: [strings]\nmaxScriptBytes: 1000\nforbiddenConstructs: [let]\n"), 0o644)
+	require.NoError(t, err)
+	p, err := LoadPolicy(file)
+	require.NoError(t, err)
+	assert.Equal(t, Policy{AllowedImports: []string{"strings"}, MaxScriptBytes: 1000, ForbiddenConstructs: []Construct{ConstructLet}}, p)
+
+	err = os.WriteFile(file, []byte("allowedImport: [strings]\n"), 0o644)
+	require.NoError(t, err)
+	_, err = LoadPolicy(file)
+	require.Error(t, err)
+}
+
+func TestPolicyFatalResult(t *testing.T) {
+	var req fnv1.RunFunctionRequest
+	err := protojson.Unmarshal([]byte(`{
+		"observed": { "composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } } }
+	}`), &req)
+	require.NoError(t, err)
+	req.Input = makeInput(t, input.CueInput{Script: "import \"strings\"\nresponse: desired: resources: main: resource: foo: strings.ToUpper(\"x\")\n"})
+	f, err := New(Options{Policy: Policy{AllowedImports: []string{"list"}}})
+	require.NoError(t, err)
+	res, err := f.RunFunction(context.Background(), &req)
+	require.Error(t, err)
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+	assert.Equal(t, `policy violation: 1:8: import "strings" is not allowed`, res.GetResults()[0].GetMessage())
+}
+
+func TestPolicySelectedScripts(t *testing.T) {
+	script := "response: desired: resources: main: resource: foo: \"bar\"\n"
+	violation := "import \"strings\"\n" + script
+	tests := []struct {
+		name string
+		in   input.CueInput
+		err  string
+	}{
+		{
+			name: "scripts",
+			in:   input.CueInput{Scripts: []input.NamedScript{{Name: "a", Script: script}, {Name: "b", Script: violation}}},
+			err:  `script "b": policy violation: 1:8: import "strings" is not allowed`,
+		},
+		{
+			name: "variant",
+			in:   input.CueInput{Script: script, Variants: []input.ScriptVariant{{Name: "v", Script: violation}}},
+			err:  `policy violation: 1:8: import "strings" is not allowed`,
+		},
+		{
+			name: "shadow script",
+			in:   input.CueInput{Script: script, ShadowScript: violation},
+			err:  `shadow script: policy violation: 1:8: import "strings" is not allowed`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := New(Options{Policy: Policy{AllowedImports: []string{"list"}}})
+			require.NoError(t, err)
+			req := makeOnErrorRequest(t, "", "a", false)
+			req.Input = makeInput(t, test.in)
+			res, err := f.RunFunction(context.Background(), req)
+			require.Error(t, err)
+			require.Len(t, res.GetResults(), 1)
+			assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+			assert.Equal(t, test.err, res.GetResults()[0].GetMessage())
+		})
+	}
+}
+
+func TestPolicyIgnoresOnError(t *testing.T) {
+	for _, onError := range []input.OnErrorPolicy{input.OnErrorWarn, input.OnErrorLastKnownGood} {
+		t.Run(string(onError), func(t *testing.T) {
+			f, err := New(Options{})
+			require.NoError(t, err)
+			_, err = f.RunFunction(context.Background(), makeOnErrorRequest(t, onError, "a", false))
+			require.NoError(t, err)
+
+			// the script has a last known good output, but violates the policy of the restarted server
+			f.policy = Policy{ForbiddenConstructs: []Construct{ConstructComprehension}}
+			res, err := f.RunFunction(context.Background(), makeOnErrorRequest(t, onError, "b", false))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "comprehension is forbidden")
+			require.Len(t, res.GetResults(), 1)
+			assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+			assert.Len(t, res.GetDesired().GetResources(), 1)
+		})
+	}
+}
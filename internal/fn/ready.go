@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// observedReady returns the readiness of the supplied observed resource based on its Ready condition.
+// A resource that has not been observed is not ready. The second return value is false if the resource
+// has been observed but has no Ready condition, in which case its readiness is unknown.
+func observedReady(observed *fnv1.Resource) (fnv1.Ready, bool) {
+	if observed == nil {
+		return fnv1.Ready_READY_FALSE, true
+	}
+	status := observed.GetResource().GetFields()["status"].GetStructValue()
+	for _, c := range status.GetFields()["conditions"].GetListValue().GetValues() {
+		fields := c.GetStructValue().GetFields()
+		if fields["type"].GetStringValue() != "Ready" {
+			continue
+		}
+		if fields["status"].GetStringValue() == "True" {
+			return fnv1.Ready_READY_TRUE, true
+		}
+		return fnv1.Ready_READY_FALSE, true
+	}
+	return fnv1.Ready_READY_UNSPECIFIED, false
+}
+
+// setAutoReady sets the readiness of the desired resources with the supplied names, when unset, from the
+// matching observed resources.
+func setAutoReady(observed, desired *fnv1.State, names []string) {
+	for _, name := range names {
+		d, ok := desired.GetResources()[name]
+		if !ok || d.GetReady() != fnv1.Ready_READY_UNSPECIFIED {
+			continue
+		}
+		if ready, known := observedReady(observed.GetResources()[name]); known {
+			d.Ready = ready
+		}
+	}
+}
+
+// setCompositeReady sets the readiness of the desired composite, when unset, to ready when all desired
+// resources are ready and no resources are pending.
+func setCompositeReady(desired *fnv1.State, pending bool) {
+	if desired.GetComposite().GetReady() != fnv1.Ready_READY_UNSPECIFIED {
+		return
+	}
+	ready := fnv1.Ready_READY_TRUE
+	if pending {
+		ready = fnv1.Ready_READY_FALSE
+	}
+	for _, d := range desired.GetResources() {
+		if d.GetReady() != fnv1.Ready_READY_TRUE {
+			ready = fnv1.Ready_READY_FALSE
+			break
+		}
+	}
+	if desired.Composite == nil {
+		desired.Composite = &fnv1.Resource{Resource: &structpb.Struct{}}
+	}
+	desired.Composite.Ready = ready
+}
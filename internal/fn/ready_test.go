@@ -0,0 +1,114 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func makeReadyRequest(t *testing.T, in input.CueInput) *fnv1.RunFunctionRequest {
+	var req fnv1.RunFunctionRequest
+	err := protojson.Unmarshal([]byte(`{
+		"observed": {
+			"composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } },
+			"resources": {
+				"ready": { "resource": { "status": { "conditions": [
+					{ "type": "Synced", "status": "True" },
+					{ "type": "Ready", "status": "True" }
+				] } } },
+				"unready": { "resource": { "status": { "conditions": [ { "type": "Ready", "status": "False" } ] } } },
+				"noconditions": { "resource": { "foo": "bar" } },
+				"explicit": { "resource": { "status": { "conditions": [ { "type": "Ready", "status": "False" } ] } } }
+			}
+		},
+		"desired": {
+			"resources": { "upstream": { "resource": { "foo": "bar" } } }
+		}
+	}`), &req)
+	require.NoError(t, err)
+	req.Input = makeInput(t, in)
+	return &req
+}
+
+func TestAutoReady(t *testing.T) {
+	script := `
+response: desired: resources: {
+	ready: resource: foo:        "bar"
+	unready: resource: foo:      "bar"
+	noconditions: resource: foo: "bar"
+	pending: resource: foo:      "bar"
+	explicit: { resource: foo: "bar", ready: "READY_TRUE" }
+}
+`
+	f, err := New(Options{})
+	require.NoError(t, err)
+
+	res, err := f.RunFunction(context.Background(), makeReadyRequest(t, input.CueInput{Script: script}))
+	require.NoError(t, err)
+	for name, r := range res.GetDesired().GetResources() {
+		if name == "explicit" {
+			continue
+		}
+		assert.Equal(t, fnv1.Ready_READY_UNSPECIFIED, r.GetReady(), name)
+	}
+	assert.Nil(t, res.GetDesired().GetComposite())
+
+	res, err = f.RunFunction(context.Background(), makeReadyRequest(t, input.CueInput{
+		Script:             script,
+		AutoReady:          true,
+		AutoReadyComposite: true,
+	}))
+	require.NoError(t, err)
+	expected := map[string]fnv1.Ready{
+		"ready":        fnv1.Ready_READY_TRUE,
+		"unready":      fnv1.Ready_READY_FALSE,
+		"noconditions": fnv1.Ready_READY_UNSPECIFIED,
+		"pending":      fnv1.Ready_READY_FALSE,
+		"explicit":     fnv1.Ready_READY_TRUE,
+		"upstream":     fnv1.Ready_READY_UNSPECIFIED,
+	}
+	for name, ready := range expected {
+		assert.Equal(t, ready, res.GetDesired().GetResources()[name].GetReady(), name)
+	}
+	assert.Equal(t, fnv1.Ready_READY_FALSE, res.GetDesired().GetComposite().GetReady())
+}
+
+func TestSetCompositeReady(t *testing.T) {
+	desired := &fnv1.State{Resources: map[string]*fnv1.Resource{
+		"a": {Ready: fnv1.Ready_READY_TRUE},
+		"b": {Ready: fnv1.Ready_READY_TRUE},
+	}}
+	setCompositeReady(desired, false)
+	assert.Equal(t, fnv1.Ready_READY_TRUE, desired.GetComposite().GetReady())
+
+	desired.Composite.Ready = fnv1.Ready_READY_UNSPECIFIED
+	setCompositeReady(desired, true)
+	assert.Equal(t, fnv1.Ready_READY_FALSE, desired.GetComposite().GetReady())
+
+	desired.Resources["c"] = &fnv1.Resource{}
+	desired.Composite.Ready = fnv1.Ready_READY_UNSPECIFIED
+	setCompositeReady(desired, false)
+	assert.Equal(t, fnv1.Ready_READY_FALSE, desired.GetComposite().GetReady())
+}
@@ -0,0 +1,162 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"cuelang.org/go/cue/format"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	recordAnnotation = "cue.fn.crossplane.io/record"
+	fixturePackage   = "tests"
+)
+
+var invalidTagChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// fixtureTag returns a tag, usable in an @if attribute and as a file name, for the supplied XR and time.
+func fixtureTag(kind, name string, t time.Time) string {
+	var parts []string
+	for _, p := range []string{kind, name, t.UTC().Format("20060102_150405")} {
+		p = strings.Trim(invalidTagChars.ReplaceAllString(strings.ToLower(p), "_"), "_")
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// fixtureLabel turns a variable expression like `foo.bar` into a label that can be used for a field declaration.
+func fixtureLabel(varName string) string {
+	return strings.ReplaceAll(varName, ".", ": ")
+}
+
+// renderFixture returns the source of a test file in the format that the cue-test tool consumes for
+// the supplied request and response JSON. The response is omitted when nil, in which case the
+// supplied error, if any, is recorded as a comment.
+func (f *Cue) renderFixture(tag string, source string, reqBytes, resBytes []byte, opts EvalOptions, evalErr error) ([]byte, error) {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "@if(%s)\npackage %s\n\n", tag, fixturePackage)
+	_, _ = fmt.Fprintf(&b, "// recorded by function-cue from %s\n", source)
+	// the fixture must reproduce the evaluation, so only redactions apply and no attributes or resources are dropped
+	filter := f.newRedactFilter(opts.Debug)
+	_, _ = fmt.Fprintf(&b, "%s: %s\n", fixtureLabel(opts.RequestVar), f.getFormattedDebugString(reqBytes, filter, DebugFormatCue))
+	switch {
+	case resBytes == nil:
+		if evalErr != nil {
+			for _, line := range strings.Split(evalErr.Error(), "\n") {
+				_, _ = fmt.Fprintf(&b, "// error: %s\n", line)
+			}
+		}
+	case opts.ResponseVar == "":
+		_, _ = fmt.Fprintf(&b, "%s\n", f.getFormattedDebugString(resBytes, filter, DebugFormatCue))
+	default:
+		_, _ = fmt.Fprintf(&b, "%s: %s\n", fixtureLabel(opts.ResponseVar), f.getFormattedDebugString(resBytes, filter, DebugFormatCue))
+	}
+	return format.Source([]byte(b.String()), format.Simplify(), format.TabIndent(true))
+}
+
+// writeFixture writes the supplied content to a file named after the tag in the record directory, adding a
+// numeric suffix to the tag when a file for it already exists. It returns the name of the file written.
+func (f *Cue) writeFixture(tag string, render func(tag string) ([]byte, error)) (string, error) {
+	if err := os.MkdirAll(f.recordDir, 0o755); err != nil {
+		return "", err
+	}
+	for i := 0; ; i++ {
+		t := tag
+		if i > 0 {
+			t = fmt.Sprintf("%s_%d", tag, i)
+		}
+		content, err := render(t)
+		if err != nil {
+			return "", err
+		}
+		file := filepath.Join(f.recordDir, t+".cue")
+		fh, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = fh.Write(content)
+		if closeErr := fh.Close(); err == nil {
+			err = closeErr
+		}
+		return file, err
+	}
+}
+
+// recording returns true if fixtures are recorded for the supplied XR.
+func (f *Cue) recording(oxr *resource.Composite) bool {
+	if f.recordDir == "" {
+		return false
+	}
+	return f.recordAll || oxr.Resource.GetAnnotations()[recordAnnotation] == "true"
+}
+
+// recordFixture records the request and the actual output of the script as a test fixture if recording is
+// enabled for the supplied XR. Errors in recording are logged and otherwise ignored.
+func (f *Cue) recordFixture(oxr *resource.Composite, req *fnv1.RunFunctionRequest, state *fnv1.RunFunctionResponse,
+	opts EvalOptions, evalErr error,
+) {
+	if !f.recording(oxr) {
+		return
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = f.log
+	}
+	reqBytes, err := protojson.Marshal(opts.RequestFields.scriptRequest(req))
+	if err != nil {
+		logger.Info("unable to record fixture", "error", err)
+		return
+	}
+	var resBytes []byte
+	if evalErr == nil {
+		if opts.DesiredOnlyResponse {
+			resBytes, err = protojson.Marshal(state.GetDesired())
+		} else {
+			resBytes, err = protojson.Marshal(state)
+		}
+		if err != nil {
+			logger.Info("unable to record fixture", "error", err)
+			return
+		}
+	}
+	kind, name := oxr.Resource.GetKind(), oxr.Resource.GetName()
+	source := fmt.Sprintf("%s/%s, step %q", kind, name, req.GetMeta().GetTag())
+	file, err := f.writeFixture(fixtureTag(kind, name, time.Now()), func(tag string) ([]byte, error) {
+		return f.renderFixture(tag, source, reqBytes, resBytes, opts, evalErr)
+	})
+	if err != nil {
+		logger.Info("unable to record fixture", "error", err)
+		return
+	}
+	logger.Info("recorded fixture", "file", file)
+}
@@ -0,0 +1,163 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestFixtureTag(t *testing.T) {
+	ts := time.Date(2023, 10, 15, 22, 35, 37, 0, time.UTC)
+	assert.Equal(t, "xs3bucket_bucket1_wztcs_20231015_223537", fixtureTag("XS3Bucket", "bucket1-wztcs", ts))
+	assert.Equal(t, "mykind_20231015_223537", fixtureTag("MyKind", "", ts))
+}
+
+func TestRecordFixture(t *testing.T) {
+	script := `
+#request: {...}
+response: desired: resources: main: resource: {
+	foo: #request.observed.composite.resource.foo
+	bar: "baz"
+}
+`
+	dir := t.TempDir()
+	f, err := New(Options{RecordDir: dir})
+	require.NoError(t, err)
+
+	req := makeRequest(t)
+	req.Input = makeInput(t, input.CueInput{Script: script})
+	_, err = f.RunFunction(context.Background(), req)
+	require.NoError(t, err)
+	files, err := filepath.Glob(filepath.Join(dir, "*.cue"))
+	require.NoError(t, err)
+	assert.Empty(t, files, "no fixtures expected without annotation")
+
+	req.Observed.Composite.Resource.Fields["metadata"].GetStructValue().
+		Fields["annotations"].GetStructValue().Fields[recordAnnotation] = structpb.NewStringValue("true")
+	for i := 0; i < 2; i++ {
+		_, err = f.RunFunction(context.Background(), req)
+		require.NoError(t, err)
+	}
+	files, err = filepath.Glob(filepath.Join(dir, "*.cue"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		require.NoError(t, err)
+		tag := strings.TrimSuffix(filepath.Base(file), ".cue")
+		assert.True(t, strings.HasPrefix(string(b), "@if("+tag+")\npackage tests\n"))
+
+		val := cuecontext.New().CompileBytes(b)
+		require.NoError(t, val.Err())
+		foo, err := val.LookupPath(cue.ParsePath("#request.observed.composite.resource.foo")).String()
+		require.NoError(t, err)
+		assert.Equal(t, "bar", foo)
+		res, err := val.LookupPath(cue.ParsePath("response")).MarshalJSON()
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"desired":{"resources":{"main":{"resource":{"bar":"baz","foo":"bar"}}}}}`, string(res))
+	}
+}
+
+func TestRenderFixtureOptions(t *testing.T) {
+	f, err := New(Options{})
+	require.NoError(t, err)
+	reqBytes := []byte(`{"observed":{"composite":{"resource":{"foo":"bar"}}}}`)
+	resBytes := []byte(`{"resources":{"main":{"resource":{"foo":"bar"}}}}`)
+
+	b, err := f.renderFixture("legacy", "test", reqBytes, resBytes, EvalOptions{RequestVar: "_request"}, nil)
+	require.NoError(t, err)
+	val := cuecontext.New().CompileBytes(b)
+	require.NoError(t, val.Err())
+	res, err := val.MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, string(resBytes), string(res))
+
+	b, err = f.renderFixture("failed", "test", reqBytes, nil, EvalOptions{RequestVar: "#request"}, errors.New("foo\nbar"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "// error: foo\n// error: bar\n")
+	assert.NotContains(t, string(b), "response")
+}
+
+func TestRenderFixtureRedactsResponse(t *testing.T) {
+	f, err := New(Options{DebugRedact: []string{"**.password"}})
+	require.NoError(t, err)
+	reqBytes := []byte(`{"observed":{"composite":{"resource":{"foo":"bar"}}}}`)
+	resBytes := []byte(`{"desired":{"resources":{"main":{
+		"resource":{"spec":{"password":"hunter2"}},
+		"connectionDetails":{"token":"c2VjcmV0"}
+	}}}}`)
+
+	b, err := f.renderFixture("redacted", "test", reqBytes, resBytes, EvalOptions{RequestVar: "#request", ResponseVar: "response"}, nil)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "hunter2")
+	assert.NotContains(t, string(b), "c2VjcmV0")
+	val := cuecontext.New().CompileBytes(b)
+	require.NoError(t, val.Err())
+	password, err := val.LookupPath(cue.ParsePath("response.desired.resources.main.resource.spec.password")).String()
+	require.NoError(t, err)
+	assert.Equal(t, redactedValue, password)
+}
+
+func TestRecordFixtureIgnoresDebugSelection(t *testing.T) {
+	script := `
+#request: {...}
+response: desired: resources: c: resource: foo: #request.observed.resources.b.resource.foo
+`
+	dir := t.TempDir()
+	f, err := New(Options{RecordDir: dir, DebugDrop: []string{"**.foo"}})
+	require.NoError(t, err)
+	req := makeRequest(t)
+	annotations := req.Observed.Composite.Resource.Fields["metadata"].GetStructValue().Fields["annotations"].GetStructValue()
+	annotations.Fields[recordAnnotation] = structpb.NewStringValue("true")
+	annotations.Fields[debugResourcesAnnotation] = structpb.NewStringValue("a")
+	req.Observed.Resources = map[string]*fnv1.Resource{
+		"b": {Resource: &structpb.Struct{Fields: map[string]*structpb.Value{"foo": structpb.NewStringValue("bar")}}},
+	}
+	req.Input = makeInput(t, input.CueInput{Script: script})
+	_, err = f.RunFunction(context.Background(), req)
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.cue"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	b, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	val := cuecontext.New().CompileBytes(b)
+	require.NoError(t, val.Err())
+	foo, err := val.LookupPath(cue.ParsePath("#request.observed.resources.b.resource.foo")).String()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", foo)
+	res, err := val.LookupPath(cue.ParsePath("response")).MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"desired":{"resources":{"c":{"resource":{"foo":"bar"}}}}}`, string(res))
+}
@@ -0,0 +1,165 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestRequestFields(t *testing.T) {
+	script := `
+import "encoding/base64"
+
+#request: {...}
+response: desired: resources: main: resource: {
+	if #request.meta != _|_ {
+		tag: #request.meta.tag
+	}
+	if #request.credentials != _|_ {
+		account: "\(base64.Decode(null, #request.credentials.aws.credentialData.data.account))"
+	}
+	if #request.input != _|_ {
+		requestVar: #request.input.requestVar
+	}
+	if #request.extraResources != _|_ {
+		extra: len(#request.extraResources.zones.items)
+	}
+}
+`
+	makeReq := func(fields []input.RequestField) *fnv1.RunFunctionRequest {
+		req := makeRequest(t)
+		req.Input = makeInput(t, input.CueInput{
+			Script:        script,
+			RequestVar:    "#request",
+			RequestFields: fields,
+			Debug:         true,
+			DebugScript:   true,
+		})
+		req.Credentials = map[string]*fnv1.Credentials{
+			"aws": {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+				Data: map[string][]byte{"account": []byte("123456789012")},
+			}}},
+		}
+		zone, err := structpb.NewStruct(map[string]any{"name": "a"})
+		require.NoError(t, err)
+		req.ExtraResources = map[string]*fnv1.Resources{
+			"zones": {Items: []*fnv1.Resource{{Resource: zone}}},
+		}
+		return req
+	}
+
+	logger := newRecordingLogger()
+	f, err := New(Options{Logger: logger, DebugFormat: DebugFormatJSON})
+	require.NoError(t, err)
+
+	res, err := f.RunFunction(context.Background(), makeReq(nil))
+	require.NoError(t, err)
+	assert.Empty(t, res.GetDesired().GetResources()["main"].GetResource().AsMap())
+
+	res, err = f.RunFunction(context.Background(), makeReq([]input.RequestField{
+		input.RequestFieldMeta,
+		input.RequestFieldCredentials,
+		input.RequestFieldInput,
+		input.RequestFieldExtraResources,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"tag":        "v1",
+		"account":    "123456789012",
+		"requestVar": "#request",
+		"extra":      float64(1),
+	}, res.GetDesired().GetResources()["main"].GetResource().AsMap())
+
+	// credentials never show up in debug output
+	entries := logger.messages("cue debug output")
+	require.NotEmpty(t, entries)
+	for _, e := range entries {
+		payload := fmt.Sprint(e.values["debug-payload"])
+		assert.NotContains(t, payload, "MTIzNDU2Nzg5MDEy") // base64 of the account
+	}
+
+	_, err = f.RunFunction(context.Background(), makeReq([]input.RequestField{"secrets"}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid request field "secrets"`)
+}
+
+func TestRequestFieldsRecorded(t *testing.T) {
+	dir := t.TempDir()
+	f, err := New(Options{History: 10, RecordDir: dir, RecordAll: true})
+	require.NoError(t, err)
+	req := makeRequest(t)
+	req.Input = makeInput(t, input.CueInput{
+		Script:     `response: desired: resources: main: resource: foo: "bar"`,
+		RequestVar: "#request",
+		RequestFields: []input.RequestField{
+			input.RequestFieldMeta,
+			input.RequestFieldCredentials,
+			input.RequestFieldExtraResources,
+		},
+	})
+	req.Credentials = map[string]*fnv1.Credentials{
+		"aws": {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+			Data: map[string][]byte{"account": []byte("123456789012")},
+		}}},
+	}
+	zone, err := structpb.NewStruct(map[string]any{"name": "a"})
+	require.NoError(t, err)
+	req.ExtraResources = map[string]*fnv1.Resources{
+		"zones": {Items: []*fnv1.Resource{{Resource: zone}}},
+	}
+	_, err = f.RunFunction(context.Background(), req)
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.cue"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	b, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "MTIzNDU2Nzg5MDEy") // base64 of the account
+	val := cuecontext.New().CompileBytes(b)
+	require.NoError(t, val.Err())
+	tag, err := val.LookupPath(cue.ParsePath("#request.meta.tag")).String()
+	require.NoError(t, err)
+	assert.Equal(t, "v1", tag)
+	creds, err := val.LookupPath(cue.ParsePath("#request.credentials.aws")).String()
+	require.NoError(t, err)
+	assert.Equal(t, redactedValue, creds)
+	zoneName, err := val.LookupPath(cue.ParsePath("#request.extraResources.zones.items[0].resource.name")).String()
+	require.NoError(t, err)
+	assert.Equal(t, "a", zoneName)
+	assert.False(t, val.LookupPath(cue.ParsePath("#request.input")).Exists())
+
+	list := f.history.list("")
+	require.Len(t, list, 1)
+	assert.Contains(t, list[0].Request, "extraResources")
+	assert.Contains(t, list[0].Request, redactedValue)
+	assert.NotContains(t, list[0].Request, "MTIzNDU2Nzg5MDEy")
+	assert.NotContains(t, list[0].Request, "input")
+}
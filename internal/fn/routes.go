@@ -0,0 +1,60 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// routeMatches returns true if the supplied route matches the group, version and kind.
+func routeMatches(r input.ScriptRoute, gvk schema.GroupVersionKind) bool {
+	return (r.Group == "" || r.Group == gvk.Group) &&
+		(r.Version == "" || r.Version == gvk.Version) &&
+		(r.Kind == "" || r.Kind == gvk.Kind)
+}
+
+// routeName returns a name for the supplied route for logs and errors.
+func routeName(r input.ScriptRoute) string {
+	orAny := func(s string) string {
+		if s == "" {
+			return "*"
+		}
+		return s
+	}
+	return orAny(r.Group) + "/" + orAny(r.Version) + ", Kind=" + orAny(r.Kind)
+}
+
+// selectRoute returns the first of the supplied routes that matches the composite, or nil if none does.
+func selectRoute(xr *resource.Composite, routes []input.ScriptRoute) (*input.ScriptRoute, error) {
+	gvk := xr.Resource.GroupVersionKind()
+	for i, r := range routes {
+		switch {
+		case r.Script == "" && len(r.Scripts) == 0:
+			return nil, errors.Errorf("route %s: script was not specified", routeName(r))
+		case r.Script != "" && len(r.Scripts) > 0:
+			return nil, errors.Errorf("route %s: only one of script and scripts can be specified", routeName(r))
+		}
+		if routeMatches(r, gvk) {
+			return &routes[i], nil
+		}
+	}
+	return nil, nil
+}
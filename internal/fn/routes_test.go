@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestRunFunctionRoutes(t *testing.T) {
+	routes := []input.ScriptRoute{
+		{
+			Group:   "example.com",
+			Version: "v1alpha1",
+			Kind:    "XBucket",
+			Script:  `response: desired: resources: main: resource: route: "bucket-v1alpha1"`,
+		},
+		{
+			Group: "example.com",
+			Kind:  "XBucket",
+			Scripts: []input.NamedScript{
+				{Name: "bucket", Script: `response: desired: resources: main: resource: route: "bucket"`},
+			},
+		},
+	}
+	tests := []struct {
+		apiVersion string
+		kind       string
+		expected   string
+	}{
+		{apiVersion: "example.com/v1alpha1", kind: "XBucket", expected: "bucket-v1alpha1"},
+		{apiVersion: "example.com/v1", kind: "XBucket", expected: "bucket"},
+		{apiVersion: "example.com/v1", kind: "XDatabase", expected: "default"},
+		{apiVersion: "other.com/v1", kind: "XBucket", expected: "default"},
+	}
+	for _, test := range tests {
+		t.Run(test.apiVersion+"/"+test.kind, func(t *testing.T) {
+			var req fnv1.RunFunctionRequest
+			err := protojson.Unmarshal([]byte(fmt.Sprintf(`{
+				"observed": { "composite": { "resource": {
+					"apiVersion": %q, "kind": %q, "metadata": { "name": "xr" }
+				} } }
+			}`, test.apiVersion, test.kind)), &req)
+			require.NoError(t, err)
+			req.Input = makeInput(t, input.CueInput{
+				Script: `response: desired: resources: main: resource: route: "default"`,
+				Routes: routes,
+			})
+			f, err := New(Options{})
+			require.NoError(t, err)
+			res, err := f.RunFunction(context.Background(), &req)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, res.GetDesired().GetResources()["main"].GetResource().AsMap()["route"])
+
+			// without a default script
+			req.Input = makeInput(t, input.CueInput{Routes: routes})
+			res, err = f.RunFunction(context.Background(), &req)
+			if test.expected == "default" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "no route matches")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, res.GetDesired().GetResources()["main"].GetResource().AsMap()["route"])
+		})
+	}
+}
+
+func TestSelectRouteInvalid(t *testing.T) {
+	xr := makeVariantXR("u", nil, nil)
+	_, err := selectRoute(xr, []input.ScriptRoute{{Kind: "XBucket"}})
+	require.Error(t, err)
+	assert.Equal(t, "route */*, Kind=XBucket: script was not specified", err.Error())
+}
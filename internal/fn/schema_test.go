@@ -0,0 +1,52 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalSchema(t *testing.T) {
+	for _, stats := range []bool{false, true} {
+		f, err := New(Options{})
+		require.NoError(t, err)
+		opts := EvalOptions{RequestVar: "#request", ResponseVar: "response", Schema: true, Stats: stats}
+
+		res, err := f.Eval(makeRequest(t), `
+#request: {...}
+response: desired: resources: main: resource: foo: #request.observed.composite.resource.foo
+response: dependencies: main: []
+`, opts)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", res.GetDesired().GetResources()["main"].GetResource().AsMap()["foo"])
+
+		typo := `response: desired: resource: main: resource: foo: "bar"`
+		_, err = f.Eval(makeRequest(t), typo, opts)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "response.desired.resource: field not allowed")
+
+		// without the schema, the error comes from protojson
+		opts.Schema = false
+		_, err = f.Eval(makeRequest(t), typo, opts)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unmarshal cue output using proto json")
+	}
+}
@@ -0,0 +1,124 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"strings"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// namedScript is a script to evaluate along with its name, which is empty for the script of the input.
+type namedScript struct {
+	name   string
+	script string
+}
+
+// namedScripts returns the supplied list of scripts after checking that they have names and content.
+func namedScripts(scripts []input.NamedScript) ([]namedScript, error) {
+	ret := make([]namedScript, 0, len(scripts))
+	seen := map[string]bool{}
+	for i, s := range scripts {
+		switch {
+		case s.Name == "":
+			return nil, errors.Errorf("scripts[%d]: name was not specified", i)
+		case seen[s.Name]:
+			return nil, errors.Errorf("scripts[%d]: duplicate name %q", i, s.Name)
+		case s.Script == "":
+			return nil, errors.Errorf("script %q: script was not specified", s.Name)
+		}
+		seen[s.Name] = true
+		ret = append(ret, namedScript{name: s.Name, script: s.Script})
+	}
+	return ret, nil
+}
+
+// combinedScript returns the text that identifies the supplied scripts for hashing purposes. This is the script
+// itself for a single, unnamed script.
+func combinedScript(scripts []namedScript) string {
+	if len(scripts) == 1 && scripts[0].name == "" {
+		return scripts[0].script
+	}
+	var b strings.Builder
+	for _, s := range scripts {
+		b.WriteString("// script: " + s.name + "\n" + s.script + "\n")
+	}
+	return b.String()
+}
+
+// scriptOutput is the output of a single script.
+type scriptOutput struct {
+	response *fnv1.RunFunctionResponse
+	patches  map[string]resourcePatch
+}
+
+// evalScripts evaluates the supplied scripts in sequence and merges the output of each into the response, such that
+// every script sees the desired state and context produced by the previous ones. It returns the outputs of
+// the scripts and their combined extension fields. The shadow script, if any, is compared with the output of every script.
+func (f *Cue) evalScripts(oxr *resource.Composite, req *fnv1.RunFunctionRequest, res *fnv1.RunFunctionResponse,
+	scripts []namedScript, shadowScript string, opts EvalOptions,
+) (*fnv1.RunFunctionResponse, []scriptOutput, *responseExtensions, error) {
+	var outputs []scriptOutput
+	ext := &responseExtensions{}
+	for _, s := range scripts {
+		scriptOpts := opts
+		wrap := errors.Wrap
+		if s.name != "" {
+			scriptOpts.Logger = opts.Logger.WithValues("script", s.name)
+			wrap = func(err error, msg string) error { return errors.Wrapf(err, "script %q: %s", s.name, msg) }
+		}
+		// the request for the script has the desired state and context merged so far
+		scriptReq := &fnv1.RunFunctionRequest{
+			Meta:           req.GetMeta(),
+			Observed:       req.GetObserved(),
+			Desired:        res.GetDesired(),
+			Context:        res.GetContext(),
+			Input:          req.GetInput(),
+			Credentials:    req.GetCredentials(),
+			ExtraResources: req.GetExtraResources(),
+		}
+		// the response shares the desired state of the request, keep a copy for the change summary
+		var upstream *fnv1.State
+		if opts.Debug.Enabled && opts.Debug.Changes {
+			upstream, _ = proto.Clone(scriptReq.GetDesired()).(*fnv1.State)
+		}
+		state, scriptExt, err := f.eval(scriptReq, s.script, scriptOpts)
+		f.recordFixture(oxr, scriptReq, state, scriptOpts, err)
+		if shadowScript != "" {
+			f.evalShadow(scriptReq, shadowScript, scriptOpts, state, err)
+		}
+		if err != nil {
+			return res, outputs, ext, wrap(err, "eval script")
+		}
+		merged, err := f.mergeResponse(res, state, scriptExt.Patches)
+		if err != nil {
+			return res, outputs, ext, wrap(err, "merge response")
+		}
+		res = merged
+		if upstream != nil {
+			f.debugChanges(upstream, scriptReq, state, res, scriptOpts)
+		}
+		outputs = append(outputs, scriptOutput{response: state, patches: scriptExt.Patches})
+		ext.merge(scriptExt)
+	}
+	return res, outputs, ext, nil
+}
@@ -0,0 +1,110 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunFunctionScripts(t *testing.T) {
+	scripts := []input.NamedScript{
+		{
+			Name: "networking",
+			Script: `
+response: desired: resources: vpc: resource: { kind: "VPC", cidr: "10.0.0.0/16" }
+response: context: "example.com/network": "vpc"
+`,
+		},
+		{
+			Name: "storage",
+			Script: `
+#request: {...}
+response: desired: resources: bucket: resource: {
+	kind: "Bucket"
+	cidr: #request.desired.resources.vpc.resource.cidr
+	network: #request.context."example.com/network"
+}
+`,
+		},
+	}
+	f, err := New(Options{})
+	require.NoError(t, err)
+	req := makeRequest(t)
+	req.Input = makeInput(t, input.CueInput{Scripts: scripts})
+	res, err := f.RunFunction(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, res.GetDesired().GetResources(), 2)
+	bucket := res.GetDesired().GetResources()["bucket"].GetResource().AsMap()
+	assert.Equal(t, "10.0.0.0/16", bucket["cidr"])
+	assert.Equal(t, "vpc", bucket["network"])
+	assert.Equal(t, "vpc", res.GetContext().AsMap()["example.com/network"])
+
+	req = makeRequest(t)
+	req.Input = makeInput(t, input.CueInput{Scripts: []input.NamedScript{
+		scripts[0],
+		{Name: "broken", Script: `response: desired: resources: x: resource: foo: 1 & 2`},
+	}})
+	_, err = f.RunFunction(context.Background(), req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `script "broken": eval script:`)
+}
+
+func TestRunFunctionScriptsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		in   input.CueInput
+		err  string
+	}{
+		{
+			name: "both",
+			in:   input.CueInput{Script: "x", Scripts: []input.NamedScript{{Name: "a", Script: "y"}}},
+			err:  "only one of script and scripts can be specified",
+		},
+		{
+			name: "no name",
+			in:   input.CueInput{Scripts: []input.NamedScript{{Script: "y"}}},
+			err:  "scripts[0]: name was not specified",
+		},
+		{
+			name: "duplicate",
+			in:   input.CueInput{Scripts: []input.NamedScript{{Name: "a", Script: "x"}, {Name: "a", Script: "y"}}},
+			err:  `scripts[1]: duplicate name "a"`,
+		},
+		{
+			name: "shadow",
+			in:   input.CueInput{Scripts: []input.NamedScript{{Name: "a", Script: "x"}}, ShadowScript: "y"},
+			err:  "variants and shadowScript cannot be used with scripts",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := New(Options{})
+			require.NoError(t, err)
+			req := makeRequest(t)
+			req.Input = makeInput(t, test.in)
+			_, err = f.RunFunction(context.Background(), req)
+			require.Error(t, err)
+			assert.Equal(t, test.err, err.Error())
+		})
+	}
+}
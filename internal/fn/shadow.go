@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"sort"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+// shadowDiff has the differences between the desired state produced by the primary script and a shadow script.
+type shadowDiff struct {
+	Added     []string            // resources only produced by the shadow script
+	Removed   []string            // resources only produced by the primary script
+	Changed   map[string][]string // paths of fields that differ, keyed by resource name
+	Composite []string            // paths of fields of the desired composite that differ
+}
+
+func (d shadowDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.Composite) == 0
+}
+
+// compareShadow returns the differences between the desired state of the supplied primary and shadow outputs.
+func compareShadow(primary, shadow *fnv1.State) shadowDiff {
+	ret := shadowDiff{Changed: map[string][]string{}}
+	for name, p := range primary.GetResources() {
+		s, ok := shadow.GetResources()[name]
+		if !ok {
+			ret.Removed = append(ret.Removed, name)
+			continue
+		}
+		if fields := resourceFieldDiffs(p, s, true); len(fields) > 0 {
+			ret.Changed[name] = fields
+		}
+	}
+	for name := range shadow.GetResources() {
+		if _, ok := primary.GetResources()[name]; !ok {
+			ret.Added = append(ret.Added, name)
+		}
+	}
+	ret.Composite = resourceFieldDiffs(primary.GetComposite(), shadow.GetComposite(), true)
+	sort.Strings(ret.Added)
+	sort.Strings(ret.Removed)
+	return ret
+}
+
+// evalShadow evaluates the supplied shadow script for the request and logs how its desired state differs from the
+// supplied output of the primary script. The output of the shadow script is discarded.
+func (f *Cue) evalShadow(req *fnv1.RunFunctionRequest, script string, opts EvalOptions,
+	primary *fnv1.RunFunctionResponse, primaryErr error,
+) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = f.log
+	}
+	// never produce debug output for the shadow script, nor statistics or budget errors that belong to the primary
+	opts.Debug = DebugOptions{}
+	opts.Stats = false
+	opts.Budget = EvalBudget{}
+	shadow, err := f.Eval(req, script, opts)
+	switch {
+	case err != nil && primaryErr != nil:
+		logger.Info("shadow script failed", "shadow-error", err.Error())
+	case err != nil:
+		logger.Info("shadow script failed where primary succeeded", "shadow-error", err.Error())
+	case primaryErr != nil:
+		logger.Info("shadow script succeeded where primary failed")
+	default:
+		d := compareShadow(primary.GetDesired(), shadow.GetDesired())
+		if d.empty() {
+			logger.Debug("shadow script output matches")
+			return
+		}
+		logger.Info("shadow script output differs",
+			"shadow-added", d.Added,
+			"shadow-removed", d.Removed,
+			"shadow-changed", d.Changed,
+			"shadow-composite", d.Composite,
+		)
+	}
+}
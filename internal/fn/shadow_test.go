@@ -0,0 +1,92 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowScript(t *testing.T) {
+	primary := `
+response: desired: resources: {
+	main: resource: { foo: "bar", size: 1 }
+	old: resource: foo: "bar"
+}
+`
+	tests := []struct {
+		name    string
+		shadow  string
+		message string
+		check   func(t *testing.T, values map[string]any)
+	}{
+		{
+			name:    "same",
+			shadow:  primary + "\n// refactored\n",
+			message: "",
+		},
+		{
+			name: "differs",
+			shadow: `
+response: desired: resources: {
+	main: resource: { foo: "baz", size: 1 }
+	new: resource: foo: "bar"
+}
+`,
+			message: "shadow script output differs",
+			check: func(t *testing.T, values map[string]any) {
+				assert.Equal(t, []string{"new"}, values["shadow-added"])
+				assert.Equal(t, []string{"old"}, values["shadow-removed"])
+				assert.Equal(t, map[string][]string{"main": {"foo"}}, values["shadow-changed"])
+			},
+		},
+		{
+			name:    "fails",
+			shadow:  `response: desired: resources: main: resource: foo: 1 & 2`,
+			message: "shadow script failed where primary succeeded",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := newRecordingLogger()
+			f, err := New(Options{Logger: logger})
+			require.NoError(t, err)
+			req := makeRequest(t)
+			req.Input = makeInput(t, input.CueInput{Script: primary, ShadowScript: test.shadow})
+			res, err := f.RunFunction(context.Background(), req)
+			require.NoError(t, err)
+			assert.Len(t, res.GetDesired().GetResources(), 2)
+			assert.Contains(t, res.GetDesired().GetResources(), "old")
+			for _, msg := range []string{"shadow script output differs", "shadow script failed where primary succeeded"} {
+				entries := logger.messages(msg)
+				if msg != test.message {
+					assert.Empty(t, entries)
+					continue
+				}
+				require.Len(t, entries, 1)
+				if test.check != nil {
+					test.check(t, entries[0].values)
+				}
+			}
+		})
+	}
+}
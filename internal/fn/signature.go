@@ -0,0 +1,110 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	"github.com/pkg/errors"
+)
+
+const digestPrefix = "sha256:"
+
+// ScriptDigest returns the digest of the supplied script in the form `sha256:<hex>`.
+func ScriptDigest(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return digestPrefix + hex.EncodeToString(sum[:])
+}
+
+// SignScript returns the digest of the supplied script along with a base64-encoded ed25519 signature of the digest.
+func SignScript(key ed25519.PrivateKey, script string) (digest, signature string) {
+	digest = ScriptDigest(script)
+	return digest, base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(digest)))
+}
+
+// parsePEM returns the key in the first PEM block of the supplied data.
+func parsePEM(data []byte, parse func([]byte) (any, error)) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return parse(block.Bytes)
+}
+
+// ParsePublicKey parses an ed25519 public key in PEM-encoded PKIX form, as produced by
+// `openssl pkey -pubout`.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	key, err := parsePEM(data, x509.ParsePKIXPublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse public key")
+	}
+	ret, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("parse public key: want an ed25519 key, got %T", key)
+	}
+	return ret, nil
+}
+
+// ParsePrivateKey parses an ed25519 private key in PEM-encoded PKCS #8 form, as produced by
+// `openssl genpkey -algorithm ed25519`.
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	key, err := parsePEM(data, x509.ParsePKCS8PrivateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse private key")
+	}
+	ret, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("parse private key: want an ed25519 key, got %T", key)
+	}
+	return ret, nil
+}
+
+// verifyScript checks that the script of the supplied input matches its digest, when specified. When a public key
+// is supplied, the script must also have a digest with a valid signature. Signatures only cover the script, such
+// that inputs that select other scripts are refused when a key is supplied.
+func verifyScript(key ed25519.PublicKey, in *input.CueInput) error {
+	if in.ScriptDigest != "" {
+		if actual := ScriptDigest(in.Script); actual != in.ScriptDigest {
+			return fmt.Errorf("script digest %s does not match the digest of the script %s", in.ScriptDigest, actual)
+		}
+	}
+	if key == nil {
+		return nil
+	}
+	if len(in.Scripts) > 0 || len(in.Variants) > 0 || len(in.Routes) > 0 || in.ShadowScript != "" {
+		return fmt.Errorf("scripts, variants, routes and shadowScript cannot be used when scripts must be signed")
+	}
+	if in.ScriptDigest == "" || in.ScriptSignature == "" {
+		return fmt.Errorf("script is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(in.ScriptSignature)
+	if err != nil {
+		return errors.Wrap(err, "decode script signature")
+	}
+	if !ed25519.Verify(key, []byte(in.ScriptDigest), sig) {
+		return fmt.Errorf("script signature does not match the script digest %s", in.ScriptDigest)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestParseKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pubBytes, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+
+	parsedPub, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}))
+	require.NoError(t, err)
+	assert.True(t, pub.Equal(parsedPub))
+	parsedPriv, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes}))
+	require.NoError(t, err)
+	assert.True(t, priv.Equal(parsedPriv))
+
+	_, err = ParsePublicKey([]byte("not a key"))
+	require.Error(t, err)
+	_, err = ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes}))
+	require.Error(t, err)
+}
+
+func TestVerifyScript(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	script := "response: desired: resources: main: resource: foo: \"bar\"\n"
+	digest, signature := SignScript(priv, script)
+	assert.Equal(t, ScriptDigest(script), digest)
+
+	tests := []struct {
+		name string
+		key  ed25519.PublicKey
+		in   input.CueInput
+		err  string
+	}{
+		{
+			name: "no key and no digest",
+			in:   input.CueInput{Script: script},
+		},
+		{
+			name: "no key and matching digest",
+			in:   input.CueInput{Script: script, ScriptDigest: digest},
+		},
+		{
+			name: "no key and mismatched digest",
+			in:   input.CueInput{Script: script + "\n", ScriptDigest: digest},
+			err:  "script digest " + digest + " does not match the digest of the script " + ScriptDigest(script+"\n"),
+		},
+		{
+			name: "signed",
+			key:  pub,
+			in:   input.CueInput{Script: script, ScriptDigest: digest, ScriptSignature: signature},
+		},
+		{
+			name: "unsigned",
+			key:  pub,
+			in:   input.CueInput{Script: script, ScriptDigest: digest},
+			err:  "script is not signed",
+		},
+		{
+			name: "other key",
+			key:  otherPub,
+			in:   input.CueInput{Script: script, ScriptDigest: digest, ScriptSignature: signature},
+			err:  "script signature does not match the script digest " + digest,
+		},
+		{
+			name: "other scripts",
+			key:  pub,
+			in: input.CueInput{
+				Script: script, ScriptDigest: digest, ScriptSignature: signature, ShadowScript: script,
+			},
+			err: "scripts, variants, routes and shadowScript cannot be used when scripts must be signed",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifyScript(test.key, &test.in)
+			if test.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, test.err, err.Error())
+		})
+	}
+}
+
+func TestRunFunctionUnsignedScript(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	var req fnv1.RunFunctionRequest
+	err = protojson.Unmarshal([]byte(`{
+		"observed": { "composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } } }
+	}`), &req)
+	require.NoError(t, err)
+	req.Input = makeInput(t, input.CueInput{Script: "response: {}\n"})
+	f, err := New(Options{ScriptKey: pub})
+	require.NoError(t, err)
+	res, err := f.RunFunction(context.Background(), &req)
+	require.Error(t, err)
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+	assert.Equal(t, "verify script: script is not signed", res.GetResults()[0].GetMessage())
+}
@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"encoding/json"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/tools/flow"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/pkg/errors"
+)
+
+// evalStats are statistics of a cue evaluation.
+type evalStats struct {
+	Unifications int64 `json:"unifications"`
+	Disjuncts    int64 `json:"disjuncts"`
+	Conjuncts    int64 `json:"conjuncts"`
+}
+
+// collectStats evaluates the supplied script, unified with the supplied values, and returns the evaluated value
+// along with the statistics of the evaluation. The cue API only reports statistics for evaluations in a workflow,
+// and compiling a script evaluates it, so the script is evaluated as a workflow that starts with an empty value
+// whose only task fills in the uncompiled script. That evaluation is the only evaluation of the script, so errors
+// in the script are returned as errors of the workflow.
+func collectStats(runtime *cue.Context, file *ast.File, fills []cue.Value) (cue.Value, evalStats, error) {
+	c := flow.New(&flow.Config{}, runtime.CompileString("{}"), func(v cue.Value) (flow.Runner, error) {
+		if len(v.Path().Selectors()) > 0 {
+			return nil, nil
+		}
+		return flow.RunnerFunc(func(t *flow.Task) error {
+			if err := t.Fill(file); err != nil {
+				return err
+			}
+			for _, fill := range fills {
+				if err := t.Fill(fill); err != nil {
+					return err
+				}
+			}
+			return nil
+		}), nil
+	})
+	if err := c.Run(context.Background()); err != nil {
+		return cue.Value{}, evalStats{}, err
+	}
+	counts := c.Stats()
+	return c.Value(), evalStats{
+		Unifications: counts.Unifications,
+		Disjuncts:    counts.Disjuncts,
+		Conjuncts:    counts.Conjuncts,
+	}, nil
+}
+
+// EvalBudget limits the statistics of an evaluation. A limit of zero means no limit.
+type EvalBudget struct {
+	MaxUnifications int64 // maximum number of unifications
+	MaxDisjuncts    int64 // maximum number of disjuncts
+	MaxConjuncts    int64 // maximum number of conjuncts
+}
+
+// isSet returns true if the budget has any limit.
+func (b EvalBudget) isSet() bool {
+	return b.MaxUnifications > 0 || b.MaxDisjuncts > 0 || b.MaxConjuncts > 0
+}
+
+// check returns an error if the supplied statistics exceed the budget.
+func (b EvalBudget) check(s evalStats) error {
+	for _, c := range []struct {
+		name         string
+		value, limit int64
+	}{
+		{"unifications", s.Unifications, b.MaxUnifications},
+		{"disjuncts", s.Disjuncts, b.MaxDisjuncts},
+		{"conjuncts", s.Conjuncts, b.MaxConjuncts},
+	} {
+		if c.limit > 0 && c.value > c.limit {
+			return errors.Errorf("evaluation used %d %s, more than the budget of %d", c.value, c.name, c.limit)
+		}
+	}
+	return nil
+}
+
+// evalStatistics evaluates the supplied script, unified with the supplied values, while collecting statistics
+// and returns the evaluated value. The statistics are emitted as debug output, recorded in metrics and checked
+// against the budget.
+func (f *Cue) evalStatistics(runtime *cue.Context, file *ast.File, fills []cue.Value, opts EvalOptions,
+	logger logging.Logger, dbgFormat DebugFormat,
+) (cue.Value, error) {
+	val, s, err := collectStats(runtime, file, fills)
+	if err != nil {
+		return val, errors.Wrap(err, "compile cue code")
+	}
+	if f.metrics != nil {
+		f.metrics.observeEval(s)
+	}
+	if opts.Debug.Enabled && !opts.Debug.Changes {
+		b, err := json.Marshal(s)
+		if err == nil {
+			debugPayload(logger, dbgFormat, "stats", "", f.getFormattedDebugString(b, &debugFilter{raw: true}, dbgFormat))
+		}
+	}
+	return val, opts.Budget.check(s)
+}
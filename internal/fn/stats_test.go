@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/parser"
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const statsScript = `
+import "list"
+
+#Item: {size: int | string | *1, tags: [...{key: string, value: string | *""}]}
+response: desired: resources: {
+	for i in list.Range(0, 20, 1) {
+		"item-\(i)": resource: #Item & {tags: [{key: "index"}]}
+	}
+}
+`
+
+func TestCollectStats(t *testing.T) {
+	collect := func(script string) (cue.Value, evalStats) {
+		file, err := parser.ParseFile("", script)
+		require.NoError(t, err)
+		val, s, err := collectStats(cuecontext.New(), file, nil)
+		require.NoError(t, err)
+		return val, s
+	}
+	_, small := collect(`a: 1`)
+	val, large := collect(statsScript)
+	assert.Greater(t, small.Unifications, int64(0))
+	assert.Greater(t, large.Unifications, small.Unifications)
+	assert.Greater(t, large.Disjuncts, small.Disjuncts)
+	assert.Greater(t, large.Conjuncts, small.Conjuncts)
+	size, err := val.LookupPath(cue.ParsePath(`response.desired.resources."item-3".resource.size`)).Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), size)
+
+	file, err := parser.ParseFile("", "a: 1 & 2")
+	require.NoError(t, err)
+	_, _, err = collectStats(cuecontext.New(), file, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "conflicting values")
+}
+
+func TestEvalStatsDebugAndMetrics(t *testing.T) {
+	logger := newRecordingLogger()
+	f, err := New(Options{Logger: logger, DebugFormat: DebugFormatJSON, EvalStats: true})
+	require.NoError(t, err)
+	_, err = f.Eval(makeRequest(t), statsScript, EvalOptions{
+		RequestVar:  "#request",
+		ResponseVar: "response",
+		Stats:       true,
+		Debug:       DebugOptions{Enabled: true, ResponseOnly: true},
+		Logger:      logger,
+	})
+	require.NoError(t, err)
+	entries := logger.messages("cue debug output")
+	require.Len(t, entries, 2)
+	assert.Equal(t, "stats", entries[0].values["debug-phase"])
+	assert.Contains(t, entries[0].values["debug-payload"], `"unifications"`)
+	assert.Equal(t, 3, testutil.CollectAndCount(f.metrics.evalCounts))
+}
+
+func TestEvalStatsIgnoreShadowScript(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	f, err := New(Options{EvalStats: true, Registerer: reg})
+	require.NoError(t, err)
+	req := makeRequest(t)
+	req.Input = makeInput(t, input.CueInput{Script: statsScript, ShadowScript: statsScript})
+	_, err = f.RunFunction(context.Background(), req)
+	require.NoError(t, err)
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	var found bool
+	for _, mf := range families {
+		if mf.GetName() != "function_cue_eval_operations" {
+			continue
+		}
+		found = true
+		require.Len(t, mf.GetMetric(), 3)
+		for _, m := range mf.GetMetric() {
+			assert.Equal(t, uint64(1), m.GetHistogram().GetSampleCount())
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestEvalBudget(t *testing.T) {
+	var req fnv1.RunFunctionRequest
+	err := protojson.Unmarshal([]byte(`{
+		"observed": { "composite": { "resource": { "apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr" } } } }
+	}`), &req)
+	require.NoError(t, err)
+	f, err := New(Options{})
+	require.NoError(t, err)
+
+	req.Input = makeInput(t, input.CueInput{Script: statsScript, EvalBudget: &input.EvalBudget{MaxUnifications: 100000}})
+	_, err = f.RunFunction(context.Background(), &req)
+	require.NoError(t, err)
+
+	req.Input = makeInput(t, input.CueInput{Script: statsScript, EvalBudget: &input.EvalBudget{MaxDisjuncts: 10}})
+	res, err := f.RunFunction(context.Background(), &req)
+	require.Error(t, err)
+	assert.Regexp(t, `^eval script: evaluation used \d+ disjuncts, more than the budget of 10$`, err.Error())
+	require.Len(t, res.GetResults(), 1)
+	assert.Equal(t, fnv1.Severity_SEVERITY_FATAL, res.GetResults()[0].GetSeverity())
+
+	req.Input = makeInput(t, input.CueInput{Script: "response: {", EvalBudget: &input.EvalBudget{MaxDisjuncts: 10}})
+	_, err = f.RunFunction(context.Background(), &req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "compile cue code: expected '}'")
+}
@@ -0,0 +1,89 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"hash/fnv"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// rolloutBucket returns a stable number between 0 and 99 for the supplied UID.
+func rolloutBucket(uid string) int32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(uid))
+	return int32(h.Sum32() % 100)
+}
+
+// selectorMatches returns true if the supplied selector matches the supplied set, or is nil.
+func selectorMatches(selector *metav1.LabelSelector, set map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+	return s.Matches(labels.Set(set)), nil
+}
+
+// variantApplies returns true if the supplied variant applies to the composite.
+func variantApplies(xr *resource.Composite, v input.ScriptVariant) (bool, error) {
+	if v.Percentage != nil && (*v.Percentage < 0 || *v.Percentage > 100) {
+		return false, errors.Errorf("percentage %d is not between 0 and 100", *v.Percentage)
+	}
+	ok, err := selectorMatches(v.LabelSelector, xr.Resource.GetLabels())
+	if err != nil {
+		return false, errors.Wrap(err, "label selector")
+	}
+	if !ok {
+		return false, nil
+	}
+	ok, err = selectorMatches(v.AnnotationSelector, xr.Resource.GetAnnotations())
+	if err != nil {
+		return false, errors.Wrap(err, "annotation selector")
+	}
+	if !ok {
+		return false, nil
+	}
+	if v.Percentage == nil {
+		return true, nil
+	}
+	return rolloutBucket(string(xr.Resource.GetUID())) < *v.Percentage, nil
+}
+
+// selectVariant returns the first of the supplied variants that applies to the composite, or nil if none does.
+func selectVariant(xr *resource.Composite, variants []input.ScriptVariant) (*input.ScriptVariant, error) {
+	for i, v := range variants {
+		if v.Script == "" {
+			return nil, errors.Errorf("variant %q: script was not specified", v.Name)
+		}
+		ok, err := variantApplies(xr, v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "variant %q", v.Name)
+		}
+		if ok {
+			return &variants[i], nil
+		}
+	}
+	return nil, nil
+}
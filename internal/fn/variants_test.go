@@ -0,0 +1,126 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fn
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	input "github.com/crossplane-contrib/function-cue/input/v1beta1"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func makeVariantXR(uid string, labels, annotations map[string]string) *resource.Composite {
+	xr := composite.New()
+	xr.SetUID(types.UID(uid))
+	xr.SetLabels(labels)
+	xr.SetAnnotations(annotations)
+	return &resource.Composite{Resource: xr}
+}
+
+func TestSelectVariant(t *testing.T) {
+	pct := func(n int32) *int32 { return &n }
+	variants := []input.ScriptVariant{
+		{
+			Name:          "dev",
+			Script:        "dev",
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "dev"}},
+		},
+		{
+			Name:   "canary",
+			Script: "canary",
+			AnnotationSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "example.com/canary", Operator: metav1.LabelSelectorOpExists},
+			}},
+			Percentage: pct(50),
+		},
+	}
+	v, err := selectVariant(makeVariantXR("u", map[string]string{"env": "dev"}, nil), variants)
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, "dev", v.Name)
+
+	v, err = selectVariant(makeVariantXR("u", map[string]string{"env": "prod"}, nil), variants)
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	// about half of the XRs with the annotation get the canary
+	canary := 0
+	for i := 0; i < 1000; i++ {
+		uid := fmt.Sprintf("uid-%d", i)
+		v, err = selectVariant(makeVariantXR(uid, nil, map[string]string{"example.com/canary": ""}), variants)
+		require.NoError(t, err)
+		if v != nil {
+			canary++
+			assert.Less(t, rolloutBucket(uid), int32(50))
+		}
+	}
+	assert.InDelta(t, 500, canary, 100)
+
+	_, err = selectVariant(makeVariantXR("u", nil, nil), []input.ScriptVariant{{Name: "bad", Script: "x", Percentage: pct(101)}})
+	require.Error(t, err)
+	assert.Equal(t, `variant "bad": percentage 101 is not between 0 and 100`, err.Error())
+
+	_, err = selectVariant(makeVariantXR("u", nil, nil), []input.ScriptVariant{{Name: "empty"}})
+	require.Error(t, err)
+	assert.Equal(t, `variant "empty": script was not specified`, err.Error())
+}
+
+func TestRunFunctionVariant(t *testing.T) {
+	f, err := New(Options{})
+	require.NoError(t, err)
+	var req fnv1.RunFunctionRequest
+	err = protojson.Unmarshal([]byte(`{
+		"observed": {
+			"composite": { "resource": {
+				"apiVersion": "v1", "kind": "MyKind", "metadata": { "name": "xr", "labels": { "env": "dev" } }
+			} }
+		}
+	}`), &req)
+	require.NoError(t, err)
+	req.Input = makeInput(t, input.CueInput{
+		Script: `response: desired: resources: main: resource: version: "v1"`,
+		Variants: []input.ScriptVariant{
+			{
+				Name:          "v2",
+				Script:        `response: desired: resources: main: resource: version: "v2"`,
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "dev"}},
+			},
+		},
+	})
+	res, err := f.RunFunction(context.Background(), &req)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", res.GetDesired().GetResources()["main"].GetResource().AsMap()["version"])
+
+	req.Input = makeInput(t, input.CueInput{
+		Script:   `response: desired: resources: main: resource: version: "v1"`,
+		Variants: []input.ScriptVariant{{Name: "none", Script: "x", Percentage: new(int32)}},
+	})
+	res, err = f.RunFunction(context.Background(), &req)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", res.GetDesired().GetResources()["main"].GetResource().AsMap()["version"])
+	assert.Equal(t, fnv1.Severity_SEVERITY_NORMAL, res.GetResults()[0].GetSeverity())
+}
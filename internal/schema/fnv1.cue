@@ -0,0 +1,117 @@
+// CUE definitions of the JSON form of the RunFunctionRequest and RunFunctionResponse messages of the
+// apiextensions.fn.proto.v1 protocol, as seen by scripts run by function-cue.
+
+// #Request is the request supplied to the script. Only the observed and desired state and the context are
+// present unless additional fields are requested in the function input.
+#Request: {
+	meta?:     #RequestMeta
+	observed?: #State
+	desired?:  #State
+	input?: {...}
+	context?: {...}
+	extraResources?: [string]: #Resources
+	credentials?: [string]:    #Credentials
+}
+
+// #Response is the response expected from the script.
+#Response: {
+	meta?:    #ResponseMeta
+	desired?: #State
+	results?: [...#Result]
+	context?: {...}
+	requirements?: #Requirements
+	conditions?: [...#Condition]
+	// dependencies is specific to function-cue and lists the names of the resources that a desired resource
+	// depends on, keyed by resource name.
+	dependencies?: [string]: [...string]
+	// patches is specific to function-cue and has patches for desired resources, keyed by resource name.
+	// A merge patch is applied before a JSON patch when both are specified.
+	patches?: [string]: #ResourcePatch
+}
+
+// #ResourcePatch is a patch for a desired resource.
+#ResourcePatch: {
+	// mergePatch is an RFC 7386 JSON merge patch.
+	mergePatch?: {...}
+	// jsonPatch is an RFC 6902 JSON patch.
+	jsonPatch?: [...#JSONPatchOperation]
+}
+
+#JSONPatchOperation: {
+	op:     "add" | "remove" | "replace" | "move" | "copy" | "test"
+	path:   string
+	from?:  string
+	value?: _
+}
+
+#RequestMeta: {
+	tag?: string
+}
+
+#ResponseMeta: {
+	tag?: string
+	// ttl is a duration in seconds with an "s" suffix, e.g. "60s".
+	ttl?: =~"^-?[0-9]+(\\.[0-9]+)?s$"
+}
+
+#State: {
+	composite?: #Resource
+	resources?: [string]: #Resource
+}
+
+#Resource: {
+	resource?: {...}
+	// values are base64 encoded.
+	connectionDetails?: [string]: string
+	ready?: #Ready
+}
+
+#Ready: "READY_UNSPECIFIED" | "READY_TRUE" | "READY_FALSE" | 0 | 1 | 2
+
+#Resources: {
+	items?: [...#Resource]
+}
+
+#Credentials: {
+	credentialData?: #CredentialData
+}
+
+#CredentialData: {
+	// values are base64 encoded.
+	data?: [string]: string
+}
+
+#Requirements: {
+	extraResources?: [string]: #ResourceSelector
+}
+
+#ResourceSelector: {
+	apiVersion?: string
+	kind?:       string
+	matchName?:  string
+	matchLabels?: {
+		labels?: [string]: string
+	}
+}
+
+#Result: {
+	severity?: #Severity
+	message?:  string
+	reason?:   string
+	target?:   #Target
+}
+
+#Severity: "SEVERITY_UNSPECIFIED" | "SEVERITY_FATAL" | "SEVERITY_WARNING" | "SEVERITY_NORMAL" | 0 | 1 | 2 | 3
+
+#Target: "TARGET_UNSPECIFIED" | "TARGET_COMPOSITE" | "TARGET_COMPOSITE_AND_CLAIM" | 0 | 1 | 2
+
+#Condition: {
+	type?:    string
+	status?:  #Status
+	reason?:  string
+	message?: string
+	target?:  #Target
+}
+
+#Status: "STATUS_CONDITION_UNSPECIFIED" | "STATUS_CONDITION_UNKNOWN" | "STATUS_CONDITION_TRUE" |
+	"STATUS_CONDITION_FALSE" | 0 | 1 | 2 | 3
@@ -0,0 +1,54 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package schema provides CUE definitions for the requests and responses that scripts deal with.
+package schema
+
+import (
+	_ "embed"
+	"fmt"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/format"
+	"github.com/pkg/errors"
+)
+
+// Names of the top-level definitions.
+const (
+	RequestDef  = "#Request"
+	ResponseDef = "#Response"
+)
+
+//go:embed fnv1.cue
+var fnv1Source string
+
+// Source returns the source of the definitions as a file in the supplied package.
+func Source(pkg string) ([]byte, error) {
+	if pkg == "" {
+		pkg = "fnv1"
+	}
+	return format.Source([]byte(fmt.Sprintf("package %s\n\n%s", pkg, fnv1Source)))
+}
+
+// Compile compiles the definitions using the supplied context and returns the value that contains them.
+func Compile(ctx *cue.Context) (cue.Value, error) {
+	v := ctx.CompileString(fnv1Source, cue.Filename("fnv1.cue"))
+	if v.Err() != nil {
+		return v, errors.Wrap(v.Err(), "compile schema")
+	}
+	return v, nil
+}
@@ -0,0 +1,61 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	b, err := Source("")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(b), "package fnv1\n"))
+
+	b, err = Source("defs")
+	require.NoError(t, err)
+	v := cuecontext.New().CompileBytes(b)
+	require.NoError(t, v.Err())
+	for _, def := range []string{RequestDef, ResponseDef} {
+		assert.True(t, v.LookupPath(cue.ParsePath(def)).Exists(), def)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	ctx := cuecontext.New()
+	defs, err := Compile(ctx)
+	require.NoError(t, err)
+	res := defs.LookupPath(cue.ParsePath(ResponseDef))
+
+	good := ctx.CompileString(`{
+		desired: resources: main: { resource: foo: "bar", ready: "READY_TRUE" }
+		results: [{ severity: "SEVERITY_NORMAL", message: "ok" }]
+		meta: ttl: "60s"
+	}`)
+	require.NoError(t, good.Unify(res).Validate(cue.Concrete(true)))
+
+	bad := ctx.CompileString(`{ desired: resource: main: resource: foo: "bar" }`)
+	err = bad.Unify(res).Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "desired.resource: field not allowed")
+}
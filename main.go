@@ -2,19 +2,114 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
 	"github.com/alecthomas/kong"
 	"github.com/crossplane-contrib/function-cue/internal/fn"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/function-sdk-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // CLI of this Function.
 type CLI struct {
-	Debug bool `short:"d" help:"Emit debug logs in addition to info logs."`
+	Debug       bool     `short:"d" help:"Emit debug logs in addition to info logs."`
+	DebugFormat string   `help:"Format of debug output for cue scripts, one of text, cue, yaml or json." default:"cue" enum:"text,cue,yaml,json"`
+	DebugDrop   []string `help:"Path patterns of attributes to remove from debug output, e.g. **.status.atProvider.policy"`
+	DebugRedact []string `help:"Path patterns of attributes to redact in debug output, e.g. **.spec.forProvider.password"`
 
 	Network     string `help:"Network on which to listen for gRPC connections." default:"tcp"`
 	Address     string `help:"Address at which to listen for gRPC connections." default:":9443"`
 	TLSCertsDir string `help:"Directory containing server certs (tls.key, tls.crt) and the CA used to verify client certificates (ca.crt)" env:"TLS_SERVER_CERTS_DIR"`
 	Insecure    bool   `help:"Run without mTLS credentials. If you supply this flag --tls-server-certs-dir will be ignored."`
+
+	DebugAddress string `help:"Address at which to serve recent evaluations over HTTP for debugging. Disabled when empty."`
+	DebugHistory int    `help:"Number of recent evaluations to keep for the debug HTTP server." default:"100"`
+
+	RecordDir string `help:"Directory to which requests and responses are recorded as cue-test fixtures for XRs annotated with cue.fn.crossplane.io/record=true."`
+	RecordAll bool   `help:"Record fixtures for all XRs, not just annotated ones. Has no effect unless --record-dir is set."`
+
+	MaxDesiredResources int `help:"Maximum number of desired resources in a response. Unlimited when 0."`
+	MaxResponseBytes    int `help:"Maximum size of a serialized response in bytes. Unlimited when 0."`
+	MaxContextKeys      int `help:"Maximum number of context keys in a response. Unlimited when 0."`
+
+	CacheTTL  time.Duration `help:"Time for which successful responses are cached for identical requests. Disabled when 0."`
+	CacheSize int           `help:"Maximum number of responses in the result cache." default:"10000"`
+
+	MetricsAddress string `help:"Address at which to serve prometheus metrics over HTTP. Disabled when empty."`
+	EvalStats      bool   `help:"Collect cue evaluation statistics for every evaluation."`
+
+	PolicyFile          string   `help:"YAML or JSON file with a policy that restricts the scripts that are evaluated." type:"existingfile"`
+	AllowedImports      []string `help:"Import paths that scripts may use, e.g. strings or encoding/*. Overrides the policy file. All imports are allowed when empty."`
+	MaxScriptBytes      int      `help:"Maximum size of a script in bytes. Overrides the policy file. Unlimited when 0."`
+	ForbiddenConstructs []string `help:"Language constructs that scripts may not use, any of import, comprehension, disjunction, default, let, attribute or interpolation. Overrides the policy file."`
+
+	ScriptPublicKey     string `help:"PEM-encoded ed25519 public key used to verify script signatures. Unsigned scripts are refused when set." env:"SCRIPT_PUBLIC_KEY"`
+	ScriptPublicKeyFile string `help:"File with a PEM-encoded ed25519 public key used to verify script signatures, e.g. mounted from a secret." type:"existingfile"`
+}
+
+// scriptKey returns the public key used to verify script signatures, if configured.
+func (c *CLI) scriptKey() (ed25519.PublicKey, error) {
+	data := []byte(c.ScriptPublicKey)
+	if c.ScriptPublicKeyFile != "" {
+		if len(data) > 0 {
+			return nil, fmt.Errorf("only one of --script-public-key and --script-public-key-file can be specified")
+		}
+		var err error
+		data, err = os.ReadFile(c.ScriptPublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return fn.ParsePublicKey(data)
+}
+
+// policy returns the policy from the policy file, if any, with the policy flags applied.
+func (c *CLI) policy() (fn.Policy, error) {
+	var p fn.Policy
+	if c.PolicyFile != "" {
+		var err error
+		p, err = fn.LoadPolicy(c.PolicyFile)
+		if err != nil {
+			return p, err
+		}
+	}
+	if len(c.AllowedImports) > 0 {
+		p.AllowedImports = c.AllowedImports
+	}
+	if c.MaxScriptBytes > 0 {
+		p.MaxScriptBytes = c.MaxScriptBytes
+	}
+	if len(c.ForbiddenConstructs) > 0 {
+		p.ForbiddenConstructs = nil
+		for _, construct := range c.ForbiddenConstructs {
+			p.ForbiddenConstructs = append(p.ForbiddenConstructs, fn.Construct(construct))
+		}
+	}
+	return p, nil
+}
+
+// serveHTTP serves the supplied handler at the supplied address in the background.
+func serveHTTP(log logging.Logger, name, address string, handler http.Handler) {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Info("serving "+name+" endpoint", "address", address)
+		if err := server.ListenAndServe(); err != nil {
+			log.Info(name+" server exited", "error", err)
+		}
+	}()
 }
 
 // Run this Function.
@@ -24,13 +119,51 @@ func (c *CLI) Run() error {
 		return err
 	}
 
+	history := 0
+	if c.DebugAddress != "" {
+		history = c.DebugHistory
+	}
+	policy, err := c.policy()
+	if err != nil {
+		return err
+	}
+	scriptKey, err := c.scriptKey()
+	if err != nil {
+		return err
+	}
+	registry := prometheus.NewRegistry()
 	f, err := fn.New(fn.Options{
-		Logger: log,
-		Debug:  c.Debug,
+		Logger:      log,
+		Debug:       c.Debug,
+		DebugFormat: fn.DebugFormat(c.DebugFormat),
+		History:     history,
+		RecordDir:   c.RecordDir,
+		RecordAll:   c.RecordAll,
+		DebugDrop:   c.DebugDrop,
+		DebugRedact: c.DebugRedact,
+		Limits: fn.Limits{
+			MaxDesiredResources: c.MaxDesiredResources,
+			MaxResponseBytes:    c.MaxResponseBytes,
+			MaxContextKeys:      c.MaxContextKeys,
+		},
+		ResultCacheTTL:  c.CacheTTL,
+		ResultCacheSize: c.CacheSize,
+		Registerer:      registry,
+		EvalStats:       c.EvalStats,
+		Policy:          policy,
+		ScriptKey:       scriptKey,
 	})
 	if err != nil {
 		return err
 	}
+	if c.DebugAddress != "" {
+		serveHTTP(log, "debug", c.DebugAddress, f.DebugHandler())
+	}
+	if c.MetricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		serveHTTP(log, "metrics", c.MetricsAddress, mux)
+	}
 	return function.Serve(f,
 		function.Listen(c.Network, c.Address),
 		function.MTLSCertificates(c.TLSCertsDir),